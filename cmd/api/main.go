@@ -1,21 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
 
-	_ "github.com/golang-migrate/migrate/source/file"
 	"github.com/mngn84/avito-cons/internal/config"
 	"github.com/mngn84/avito-cons/internal/handlers"
 	"github.com/mngn84/avito-cons/internal/services"
-	"github.com/mngn84/avito-cons/internal/storage/pg"
 )
 
 func main() {
@@ -36,23 +40,87 @@ func main() {
 		"port", cfg.Webhook.Port,
 	)
 
-	r := chi.NewRouter()
+	if cfg.Webhook.Auth == "none" {
+		logger.Warn("WEBHOOK_AUTH is none, webhooks are accepted without authentication")
+	}
 
-	db, err := pg.NewPgClient(cfg, logger)
+	// waits for the database, so migrations do not race its start
+	db, err := openStore(cfg, logger)
 	if err != nil {
 		log.Fatal("DB error: ", err)
 	}
 
-	avito := services.NewAvitoService(cfg, logger)
-	openai := services.NewOpenAIService(cfg, logger, db)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, logger, db.DB(), os.Args[2:])
+		db.Close()
+		return
+	}
+
+	// a SQLite database is always brought up to date, there is nobody else
+	// to migrate it and a :memory: one starts empty
+	if cfg.DB.Migrate || cfg.DB.Driver() == config.DriverSqlite {
+		runMigrate(cfg, logger, db.DB(), []string{"up"})
+	}
+
+	r := chi.NewRouter()
+
+	profiles := services.NewProfileService(cfg, logger, db)
+	tokens := services.NewAvitoTokenProvider(cfg, logger, profiles)
+	avito := services.NewAvitoService(cfg, logger, tokens)
+	tools := services.NewToolRegistry(logger)
+	services.RegisterItemTools(tools, avito)
+	services.RegisterEscalationTool(tools)
+	openaiClient, err := services.NewOpenAIClientConfig(cfg)
+	if err != nil {
+		log.Fatal("OpenAI client error: ", err)
+	}
+	compatible, err := services.NewCompatibleProvider(cfg)
+	if err != nil {
+		log.Fatal("LLM provider error: ", err)
+	}
+	openai := services.NewBackendRouter(map[string]services.OpenAIService{
+		services.BackendAssistants: services.NewOpenAIService(cfg, logger, db, profiles, tools, openaiClient),
+		services.BackendChat: services.NewChatService(cfg, logger, db, map[string]services.Provider{
+			services.ProviderOpenAI:     services.NewOpenAIProvider(openaiClient),
+			services.ProviderCompatible: compatible,
+			services.ProviderFake:       services.NewFakeProvider(cfg),
+		}, tools),
+	})
 	upload := services.NewUploadService(openai, logger)
-	h := handlers.NewWebhookHandler(avito, openai, logger)
+	delivery := services.NewDeliveryService(logger, avito, db)
+	voice := services.NewVoiceService(logger, avito, services.NewWhisperTranscriber(cfg, openaiClient), db)
+	handoff := services.NewHandoffService(cfg, logger, db)
+	escalation := services.NewEscalationService(logger, handoff, services.NewNotifier(cfg, logger))
+	history := services.NewHistoryService(logger, db)
+	queue := services.NewQueueService(cfg, logger, db)
+	subscriptions := services.NewSubscriptionService(cfg, logger, avito, profiles)
+	handlers.WarnWebhookAuth(context.Background(), profiles, logger)
+	h := handlers.NewWebhookHandler(avito, openai, delivery, voice, handoff, escalation, history, queue, profiles, logger)
 
-	r.Use(middleware.Logger)
+	r.Use(handlers.RequestLogger())
 	r.Use(middleware.Recoverer)
 
-	r.Post("/webhook", h.ServerHTTP)
+	r.Group(func(r chi.Router) {
+		r.Use(handlers.WebhookAuthMiddleware(profiles, handlers.NewAuthenticators(cfg), logger))
+		r.Post("/webhook", h.ServerHTTP)
+		r.Post("/webhook/{secret}", h.ServerHTTP)
+	})
+	if cfg.Admin.Token != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(handlers.AdminAuthMiddleware(cfg.Admin.Token))
+			r.Post("/webhook/sync", handlers.SyncSubscriptionsHandler(subscriptions))
+			r.Get("/accounts/{userId}/webhook", handlers.ListSubscriptionsHandler(subscriptions))
+			r.Post("/accounts/{userId}/webhook", handlers.SubscribeHandler(subscriptions))
+			r.Delete("/accounts/{userId}/webhook", handlers.UnsubscribeHandler(subscriptions))
+			r.Get("/accounts/{userId}/chats/{chatId}/state", handlers.ChatStateHandler(handoff))
+			r.Post("/accounts/{userId}/chats/{chatId}/pause", handlers.PauseChatHandler(handoff, cfg.Handoff.PauseTTL))
+			r.Post("/accounts/{userId}/chats/{chatId}/handoff", handlers.HandOffChatHandler(handoff))
+			r.Post("/accounts/{userId}/chats/{chatId}/resume", handlers.ResumeChatHandler(handoff))
+		})
+		r.With(handlers.AdminAuthMiddleware(cfg.Admin.Token)).Handle("/debug/vars", expvar.Handler())
+	}
 	r.Get("/health", handlers.HealthCheckHandler())
+	r.Get("/ready", handlers.ReadinessHandler(db, logger))
 	r.Post("/upload", handlers.UploadFileHandler(upload))
 
 	server := &http.Server{
@@ -60,9 +128,39 @@ func main() {
 		Handler: r,
 	}
 
-	e := server.ListenAndServe()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	queue.Start(ctx, h.HandleAvitoMsg)
+
+	go func() {
+		e := server.ListenAndServe()
+
+		if e != nil && !errors.Is(e, http.ErrServerClosed) {
+			log.Fatal("Server error: ", e)
+		}
+	}()
+
+	if cfg.Webhook.Subscribe {
+		go func() {
+			if err := subscriptions.Sync(ctx); err != nil {
+				logger.Error("webhook subscription failed", "error", err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	logger.Info("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Server shutdown error", "error", err)
+	}
+	queue.Wait()
 
-	if e != nil {
-		log.Fatal("Server error: ", e)
+	if err := db.Close(); err != nil {
+		logger.Error("DB close error", "error", err)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/storage/schema"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate handles `migrate up`, `migrate down [steps]` and
+// `migrate status`; down rolls back one migration unless told otherwise.
+func runMigrate(cfg *config.Config, logger *slog.Logger, db *sql.DB, args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	migrator, err := schema.NewMigrator(cfg, logger, db)
+	if err != nil {
+		log.Fatal("Migration error: ", err)
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				log.Fatal(migrateUsage)
+			}
+		}
+		err = migrator.Down(steps)
+	case "status":
+		var status schema.MigrationStatus
+		status, err = migrator.Status()
+		if err == nil {
+			fmt.Printf("version=%d latest=%d dirty=%t\n", status.Version, status.Latest, status.Dirty)
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+
+	if err != nil {
+		migrator.Close()
+		log.Fatal("Migration error: ", err)
+	}
+}
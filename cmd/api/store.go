@@ -0,0 +1,25 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/storage"
+	"github.com/mngn84/avito-cons/internal/storage/pg"
+	"github.com/mngn84/avito-cons/internal/storage/sqlite"
+)
+
+// store is a storage.Store that also hands out its connection for migrations.
+type store interface {
+	storage.Store
+	DB() *sql.DB
+}
+
+// openStore connects to the database chosen by the DATABASE_URL scheme.
+func openStore(cfg *config.Config, logger *slog.Logger) (store, error) {
+	if cfg.DB.Driver() == config.DriverSqlite {
+		return sqlite.NewSqliteClient(cfg, logger)
+	}
+	return pg.NewPgClient(cfg, logger)
+}
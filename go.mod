@@ -3,10 +3,10 @@ module github.com/mngn84/avito-cons
 go 1.22.5
 
 require (
-	github.com/go-chi/chi/v5 v5.2.0 // indirect
+	github.com/go-chi/chi/v5 v5.2.0
 	github.com/golang-migrate/migrate v3.5.4+incompatible
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/joho/godotenv v1.5.1
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.24
-	github.com/sashabaranov/go-openai v1.36.1 // indirect
+	github.com/sashabaranov/go-openai v1.36.1
 )
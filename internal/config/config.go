@@ -2,16 +2,25 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 func New() (*Config, error) {
 	cfg := &Config{
 		Webhook: WebhookConfig{
-			Host: getEnv("WEBHOOK_HOST", "0:0:0:0"),
-			Port: getEnv("WEBHOOK_PORT", "10000"),
+			Host:            getEnv("WEBHOOK_HOST", "0:0:0:0"),
+			Port:            getEnv("WEBHOOK_PORT", "10000"),
+			Auth:            getEnv("WEBHOOK_AUTH", "secret"),
+			Secret:          getEnv("WEBHOOK_SECRET", ""),
+			AllowedIPs:      getEnv("WEBHOOK_ALLOWED_IPS", ""),
+			SecretHeader:    getEnv("WEBHOOK_SECRET_HEADER", "X-Webhook-Secret"),
+			SignatureHeader: getEnv("WEBHOOK_SIGNATURE_HEADER", "X-Webhook-Signature"),
+			TrustProxy:      getBool("WEBHOOK_TRUST_PROXY", false),
+			Subscribe:       getBool("WEBHOOK_SUBSCRIBE", false),
 		},
 		OpenAI: OpenAIConfig{
 			ApiKey:       getEnv("OPENAI_API_KEY", ""),
@@ -19,16 +28,46 @@ func New() (*Config, error) {
 			ApiUrl:       getEnv("OPENAI_URL", "https://api.openai.com/v1/"),
 			SystemPrompt: getEnv("OPENAI_PROMPT", "You are a helpful assistant."),
 			Temperature:  getFloat32("OPENAI_TEMPERATURE", 0.5),
-			Timeout:      getDuration("OPENAI_TIMEOUT", 3*time.Second),
+			Timeout:      getDuration("OPENAI_TIMEOUT", time.Minute),
+			PollInterval: getDuration("OPENAI_POLL_INTERVAL", 250*time.Millisecond),
+			PollMaxInterval: getDuration("OPENAI_POLL_MAX_INTERVAL", 4*time.Second),
+			Stream:          getBool("OPENAI_STREAM", false),
+			Backend:         getEnv("OPENAI_BACKEND", "assistants"),
+			TranscriptionModel: getEnv("OPENAI_TRANSCRIPTION_MODEL", "whisper-1"),
+			Organization:       getEnv("OPENAI_ORGANIZATION", ""),
+			Project:            getEnv("OPENAI_PROJECT", ""),
+			ProxyUrl:           getEnv("OPENAI_PROXY_URL", ""),
+			CAFile:             getEnv("OPENAI_CA_FILE", ""),
+			RequestTimeout:     getDuration("OPENAI_REQUEST_TIMEOUT", time.Minute),
+		},
+		LLM: LLMConfig{
+			Provider:         getEnv("LLM_PROVIDER", "openai"),
+			CompatibleUrl:    getEnv("LLM_COMPATIBLE_URL", "http://localhost:11434/v1"),
+			CompatibleApiKey: getEnv("LLM_COMPATIBLE_API_KEY", ""),
+			FakeReply:        getEnv("LLM_FAKE_REPLY", ""),
 		},
 		Avito: AvitoConfig{
-			Token:   getEnv("AVITO_TOKEN", ""),
-			ApiUrl:  getEnv("AVITO_API_URL", "https://api.avito.ru"),
-			timeout: getDuration("AVITO_TIMEOUT", 3*time.Second),
+			Token:              getEnv("AVITO_TOKEN", ""),
+			ClientId:           getEnv("AVITO_CLIENT_ID", ""),
+			ClientSecret:       getEnv("AVITO_CLIENT_SECRET", ""),
+			TokenRefreshMargin: getDuration("AVITO_TOKEN_REFRESH_MARGIN", 5*time.Minute),
+			ApiUrl:             getEnv("AVITO_API_URL", "https://api.avito.ru"),
+			SendMode:           getEnv("AVITO_SEND_MODE", "auto"),
+			ProfileCacheTTL:    getDuration("AVITO_PROFILE_CACHE_TTL", time.Minute),
+			ImageHosts:         getEnv("AVITO_IMAGE_HOSTS", "avito.st"),
+			timeout:            getDuration("AVITO_TIMEOUT", 3*time.Second),
 		},
 		DB: PgConfig{
-			URL:      getEnv("POSTGRES_URL", ""),
+			URL:      getEnv("DATABASE_URL", getEnv("POSTGRES_URL", "")),
 			HistoryLimit: getInt("POSTGRES_LIMIT", 5),
+			MaxOpenConns:      getInt("POSTGRES_MAX_OPEN_CONNS", 10),
+			MaxIdleConns:      getInt("POSTGRES_MAX_IDLE_CONNS", 5),
+			ConnMaxLifetime:   getDuration("POSTGRES_CONN_MAX_LIFETIME", 30*time.Minute),
+			ConnMaxIdleTime:   getDuration("POSTGRES_CONN_MAX_IDLE_TIME", 5*time.Minute),
+			ConnectRetries:    getInt("POSTGRES_CONNECT_RETRIES", 5),
+			ConnectRetryDelay: getDuration("POSTGRES_CONNECT_RETRY_DELAY", 2*time.Second),
+			Migrate:        getBool("POSTGRES_MIGRATE", false),
+			MigrationsPath: getEnv("POSTGRES_MIGRATIONS", "file://migrations"),
 			// Host:     getEnv("POSTGRES_HOST", "localhost"),
 			// Port:     getEnv("POSTGRES_PORT", "5432"),
 			// User:     getEnv("POSTGRES_USER", "postgres"),
@@ -36,6 +75,30 @@ func New() (*Config, error) {
 			// DbName:   getEnv("POSTGRES_DB", "chatbot"),
 			// SSLMode:  getEnv("POSTGRES_SSL_MODE", "disable"),
 		},
+		Queue: QueueConfig{
+			Workers:       getInt("QUEUE_WORKERS", 4),
+			PollInterval:  getDuration("QUEUE_POLL_INTERVAL", time.Second),
+			LeaseDuration: getDuration("QUEUE_LEASE", 5*time.Minute),
+			MaxAttempts:   getInt("QUEUE_MAX_ATTEMPTS", 5),
+			RetryDelay:    getDuration("QUEUE_RETRY_DELAY", 10*time.Second),
+		},
+		Admin: AdminConfig{
+			Token: getEnv("ADMIN_TOKEN", ""),
+		},
+		Handoff: HandoffConfig{
+			PauseTTL: getDuration("HANDOFF_PAUSE_TTL", 24*time.Hour),
+		},
+		Notify: NotifyConfig{
+			WebhookUrl:     getEnv("NOTIFY_WEBHOOK_URL", ""),
+			TelegramApiUrl: getEnv("NOTIFY_TELEGRAM_API_URL", "https://api.telegram.org"),
+			TelegramToken:  getEnv("NOTIFY_TELEGRAM_TOKEN", ""),
+			TelegramChatId: getEnv("NOTIFY_TELEGRAM_CHAT_ID", ""),
+			SMTPAddr:       getEnv("NOTIFY_SMTP_ADDR", ""),
+			SMTPUser:       getEnv("NOTIFY_SMTP_USER", ""),
+			SMTPPassword:   getEnv("NOTIFY_SMTP_PASSWORD", ""),
+			SMTPFrom:       getEnv("NOTIFY_SMTP_FROM", ""),
+			SMTPTo:         getEnv("NOTIFY_SMTP_TO", ""),
+		},
 	}
 	if err := cfg.validate(); err != nil {
 		return nil, err
@@ -44,15 +107,107 @@ func New() (*Config, error) {
 }
 
 func (c *Config) validate() error {
-	if c.OpenAI.ApiKey == "" {
+	// local setups may run the chat backend without OpenAI at all
+	if c.OpenAI.ApiKey == "" && (c.LLM.Provider == "openai" || c.OpenAI.Backend == "assistants") {
 		return fmt.Errorf("OPENAI_API_KEY is required")
 	}
-	if c.Avito.Token == "" {
-		return fmt.Errorf("AVITO_TOKEN is required")
+	if (c.Avito.ClientId == "") != (c.Avito.ClientSecret == "") {
+		return fmt.Errorf("AVITO_CLIENT_ID and AVITO_CLIENT_SECRET must be set together")
+	}
+	if c.Avito.SendMode != "auto" && c.Avito.SendMode != "draft" {
+		return fmt.Errorf("AVITO_SEND_MODE must be auto or draft")
+	}
+	if c.Notify.TelegramToken != "" && c.Notify.TelegramChatId == "" {
+		return fmt.Errorf("NOTIFY_TELEGRAM_CHAT_ID is required with NOTIFY_TELEGRAM_TOKEN")
+	}
+	if c.Notify.SMTPAddr != "" && (c.Notify.SMTPFrom == "" || c.Notify.SMTPTo == "") {
+		return fmt.Errorf("NOTIFY_SMTP_FROM and NOTIFY_SMTP_TO are required with NOTIFY_SMTP_ADDR")
+	}
+	if c.OpenAI.Backend != "assistants" && c.OpenAI.Backend != "chat" {
+		return fmt.Errorf("OPENAI_BACKEND must be assistants or chat")
+	}
+	switch c.LLM.Provider {
+	case "openai", "compatible", "fake":
+	default:
+		return fmt.Errorf("LLM_PROVIDER must be openai, compatible or fake")
+	}
+	if c.OpenAI.Timeout <= 0 {
+		return fmt.Errorf("OPENAI_TIMEOUT must be positive")
+	}
+	if c.OpenAI.RequestTimeout <= 0 {
+		return fmt.Errorf("OPENAI_REQUEST_TIMEOUT must be positive")
+	}
+	if c.OpenAI.ProxyUrl != "" {
+		if _, err := url.Parse(c.OpenAI.ProxyUrl); err != nil {
+			return fmt.Errorf("OPENAI_PROXY_URL is invalid: %w", err)
+		}
+	}
+	if c.OpenAI.PollInterval <= 0 || c.OpenAI.PollMaxInterval < c.OpenAI.PollInterval {
+		return fmt.Errorf("OPENAI_POLL_INTERVAL must be positive and not above OPENAI_POLL_MAX_INTERVAL")
+	}
+	if c.DB.Driver() == DriverSqlite && c.DB.SqlitePath() == "" {
+		return fmt.Errorf("DATABASE_URL needs a file path, e.g. sqlite://./bot.db")
+	}
+	if c.DB.MaxOpenConns < 1 || c.DB.MaxIdleConns < 0 {
+		return fmt.Errorf("POSTGRES_MAX_OPEN_CONNS must be positive and POSTGRES_MAX_IDLE_CONNS not negative")
+	}
+	if c.DB.ConnectRetries < 0 {
+		return fmt.Errorf("POSTGRES_CONNECT_RETRIES must not be negative")
+	}
+	if c.Webhook.Subscribe {
+		u, err := url.Parse(c.Webhook.Host)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("WEBHOOK_HOST must be the public http(s) url of the bot with WEBHOOK_SUBSCRIBE")
+		}
+	}
+	for _, method := range strings.Split(c.Webhook.Auth, ",") {
+		switch strings.TrimSpace(method) {
+		case "none", "ip":
+		case "secret", "hmac":
+			// the account of the global credentials has no secret of its own
+			if c.Webhook.Secret == "" && (c.Avito.Token != "" || c.Avito.ClientId != "") {
+				return fmt.Errorf("WEBHOOK_SECRET is required with WEBHOOK_AUTH=%s", strings.TrimSpace(method))
+			}
+		default:
+			return fmt.Errorf("WEBHOOK_AUTH must list none, secret, hmac or ip")
+		}
+	}
+	if c.Queue.Workers < 1 {
+		return fmt.Errorf("QUEUE_WORKERS must be positive")
+	}
+	if c.Queue.MaxAttempts < 1 {
+		return fmt.Errorf("QUEUE_MAX_ATTEMPTS must be positive")
+	}
+	if c.Queue.PollInterval <= 0 || c.Queue.LeaseDuration <= 0 {
+		return fmt.Errorf("QUEUE_POLL_INTERVAL and QUEUE_LEASE must be positive")
+	}
+	if c.Queue.RetryDelay < 0 {
+		return fmt.Errorf("QUEUE_RETRY_DELAY must not be negative")
 	}
 	return nil
 }
 
+const (
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+)
+
+// Driver picks the storage by the scheme of DATABASE_URL: sqlite:// or
+// sqlite3:// for SQLite, anything else is handed to Postgres.
+func (c PgConfig) Driver() string {
+	if strings.HasPrefix(c.URL, "sqlite://") || strings.HasPrefix(c.URL, "sqlite3://") {
+		return DriverSqlite
+	}
+	return DriverPostgres
+}
+
+// SqlitePath is the database file with its query options, e.g. ./bot.db
+// for sqlite://./bot.db.
+func (c PgConfig) SqlitePath() string {
+	path := strings.TrimPrefix(c.URL, "sqlite3://")
+	return strings.TrimPrefix(path, "sqlite://")
+}
+
 func getEnv(key, defaultVal string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
@@ -85,4 +240,13 @@ func getInt(key string, defaultVal int) int {
         }
     }
     return defaultVal
+}
+
+func getBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return defaultVal
 }
\ No newline at end of file
@@ -5,13 +5,27 @@ import "time"
 type Config struct {
  Webhook WebhookConfig
  OpenAI OpenAIConfig
+ LLM LLMConfig
  Avito AvitoConfig
  DB PgConfig
+ Queue QueueConfig
+ Admin AdminConfig
+ Handoff HandoffConfig
+ Notify NotifyConfig
 }
 
 type WebhookConfig struct {
 	Host string
 	Port string
+	// default for accounts without their own: secret, hmac, ip or none
+	Auth string
+	Secret string
+	AllowedIPs string
+	SecretHeader string
+	SignatureHeader string
+	TrustProxy bool
+	// subscribe the accounts to WEBHOOK_HOST on start, off by default
+	Subscribe bool
 }
 
 type OpenAIConfig struct {
@@ -21,11 +35,38 @@ type OpenAIConfig struct {
 	SystemPrompt string
 	Temperature float32
 	Timeout time.Duration
+	PollInterval time.Duration
+	PollMaxInterval time.Duration
+	Stream bool
+	Backend string
+	TranscriptionModel string
+	Organization string
+	Project string
+	// empty means HTTPS_PROXY and friends from the environment
+	ProxyUrl string
+	// PEM bundle trusted in addition to the system roots
+	CAFile string
+	// a single HTTP request, OPENAI_TIMEOUT bounds the whole run
+	RequestTimeout time.Duration
+}
+
+type LLMConfig struct {
+	Provider string
+	CompatibleUrl string
+	CompatibleApiKey string
+	FakeReply string
 }
 
 type AvitoConfig struct {
 	Token string
+	ClientId string
+	ClientSecret string
+	TokenRefreshMargin time.Duration
 	ApiUrl string
+	SendMode string
+	ProfileCacheTTL time.Duration
+	// hosts, with their subdomains, message images are downloaded from
+	ImageHosts string
 	timeout time.Duration
 }
 
@@ -38,4 +79,43 @@ type PgConfig struct {
 	DbName string
 	SSLMode string
 	HistoryLimit int
+	// Postgres connection pool
+	MaxOpenConns int
+	MaxIdleConns int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// pings at startup after the first failed one
+	ConnectRetries int
+	ConnectRetryDelay time.Duration
+	// apply pending migrations before serving, SQLite is always migrated
+	Migrate bool
+	MigrationsPath string
+}
+
+type QueueConfig struct {
+	Workers int
+	PollInterval time.Duration
+	LeaseDuration time.Duration
+	MaxAttempts int
+	RetryDelay time.Duration
+}
+
+type AdminConfig struct {
+	Token string
+}
+
+type HandoffConfig struct {
+	PauseTTL time.Duration
+}
+
+type NotifyConfig struct {
+	WebhookUrl string
+	TelegramApiUrl string
+	TelegramToken string
+	TelegramChatId string
+	SMTPAddr string
+	SMTPUser string
+	SMTPPassword string
+	SMTPFrom string
+	SMTPTo string
 }
\ No newline at end of file
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mngn84/avito-cons/internal/services"
+)
+
+// AdminAuthMiddleware requires "Authorization: Bearer <ADMIN_TOKEN>".
+func AdminAuthMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ListSubscriptionsHandler(subs services.SubscriptionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := userIdParam(w, r)
+		if !ok {
+			return
+		}
+
+		list, err := subs.List(r.Context(), userId)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]any{"subscriptions": list})
+	}
+}
+
+func SubscribeHandler(subs services.SubscriptionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := userIdParam(w, r)
+		if !ok {
+			return
+		}
+
+		webhookUrl, err := subs.Subscribe(r.Context(), userId)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]string{"url": webhookUrl})
+	}
+}
+
+func UnsubscribeHandler(subs services.SubscriptionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := userIdParam(w, r)
+		if !ok {
+			return
+		}
+
+		if err := subs.Unsubscribe(r.Context(), userId); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"ok": true})
+	}
+}
+
+func SyncSubscriptionsHandler(subs services.SubscriptionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := subs.Sync(r.Context()); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"ok": true})
+	}
+}
+
+func ChatStateHandler(handoff services.HandoffService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := userIdParam(w, r)
+		if !ok {
+			return
+		}
+
+		state, err := handoff.State(r.Context(), userId, chi.URLParam(r, "chatId"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]any{
+			"chat_id":      state.ChatId,
+			"state":        state.State,
+			"paused_until": state.PausedUntil,
+			"reason":       state.Reason,
+		})
+	}
+}
+
+// PauseChatHandler pauses the bot for ?ttl=<duration>, the configured
+// HANDOFF_PAUSE_TTL by default; ttl=0 pauses until resumed.
+func PauseChatHandler(handoff services.HandoffService, defaultTTL time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := userIdParam(w, r)
+		if !ok {
+			return
+		}
+
+		ttl := defaultTTL
+		if value := r.URL.Query().Get("ttl"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				http.Error(w, "Invalid ttl", http.StatusBadRequest)
+				return
+			}
+			ttl = parsed
+		}
+
+		if err := handoff.Pause(r.Context(), userId, chi.URLParam(r, "chatId"), ttl, "admin"); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"ok": true})
+	}
+}
+
+func HandOffChatHandler(handoff services.HandoffService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := userIdParam(w, r)
+		if !ok {
+			return
+		}
+
+		if err := handoff.HandOff(r.Context(), userId, chi.URLParam(r, "chatId"), "admin"); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"ok": true})
+	}
+}
+
+func ResumeChatHandler(handoff services.HandoffService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := userIdParam(w, r)
+		if !ok {
+			return
+		}
+
+		if err := handoff.Resume(r.Context(), userId, chi.URLParam(r, "chatId")); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		writeJSON(w, map[string]bool{"ok": true})
+	}
+}
+
+func userIdParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "userId"))
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return 0, false
+	}
+	return userId, true
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownProfile):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrNoWebhookUrl):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
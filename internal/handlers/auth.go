@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/services"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+var rejectedWebhooks = expvar.NewMap("webhook_auth_rejected")
+
+type Authenticator interface {
+	Authenticate(r *http.Request, body []byte, profile *storage.Profile) error
+}
+
+type hmacAuthenticator struct {
+	header string
+}
+
+// NewHMACAuthenticator checks a hex encoded HMAC-SHA256 of the request body,
+// optionally prefixed with "sha256=", keyed with the profile webhook secret.
+func NewHMACAuthenticator(header string) Authenticator {
+	return &hmacAuthenticator{header: header}
+}
+
+func (a *hmacAuthenticator) Authenticate(r *http.Request, body []byte, profile *storage.Profile) error {
+	if profile.WebhookSecret == "" {
+		return errors.New("webhook secret is not configured")
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(a.header), "sha256="))
+	if err != nil || len(signature) == 0 {
+		return errors.New("missing or malformed signature")
+	}
+
+	mac := hmac.New(sha256.New, []byte(profile.WebhookSecret))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
+
+type secretAuthenticator struct {
+	header string
+}
+
+// NewSecretAuthenticator accepts the shared secret either in the header or
+// as the last path segment of /webhook/{secret}.
+func NewSecretAuthenticator(header string) Authenticator {
+	return &secretAuthenticator{header: header}
+}
+
+func (a *secretAuthenticator) Authenticate(r *http.Request, body []byte, profile *storage.Profile) error {
+	if profile.WebhookSecret == "" {
+		return errors.New("webhook secret is not configured")
+	}
+
+	secret := r.Header.Get(a.header)
+	if secret == "" {
+		secret = chi.URLParam(r, "secret")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(profile.WebhookSecret)) != 1 {
+		return errors.New("secret mismatch")
+	}
+
+	return nil
+}
+
+type ipAuthenticator struct {
+	trustProxy bool
+}
+
+// NewIPAuthenticator accepts requests from the comma separated IPs and CIDRs
+// of the profile. With trustProxy the client address is taken from
+// X-Forwarded-For, which is only safe behind a proxy that overwrites it.
+func NewIPAuthenticator(trustProxy bool) Authenticator {
+	return &ipAuthenticator{trustProxy: trustProxy}
+}
+
+func (a *ipAuthenticator) Authenticate(r *http.Request, body []byte, profile *storage.Profile) error {
+	ip := a.clientIP(r)
+	if ip == nil {
+		return errors.New("cannot determine client ip")
+	}
+
+	for _, entry := range strings.Split(profile.WebhookIPs, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return nil
+			}
+			continue
+		}
+		if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("ip %s is not allowed", ip)
+}
+
+func (a *ipAuthenticator) clientIP(r *http.Request) net.IP {
+	if a.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return net.ParseIP(strings.TrimSpace(strings.Split(forwarded, ",")[0]))
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func NewAuthenticators(cfg *config.Config) map[string]Authenticator {
+	return map[string]Authenticator{
+		"hmac":   NewHMACAuthenticator(cfg.Webhook.SignatureHeader),
+		"secret": NewSecretAuthenticator(cfg.Webhook.SecretHeader),
+		"ip":     NewIPAuthenticator(cfg.Webhook.TrustProxy),
+	}
+}
+
+// missingAuthSettings returns the auth methods of the account that reject
+// every webhook because a setting they need is empty.
+func missingAuthSettings(profile *storage.Profile) []string {
+	missing := []string{}
+	for _, method := range strings.Split(profile.WebhookAuth, ",") {
+		switch method = strings.TrimSpace(method); method {
+		case "secret", "hmac":
+			if profile.WebhookSecret == "" {
+				missing = append(missing, method)
+			}
+		case "ip":
+			if strings.TrimSpace(profile.WebhookIPs) == "" {
+				missing = append(missing, method)
+			}
+		}
+	}
+	return missing
+}
+
+// WarnWebhookAuth logs every account whose webhooks would all be rejected,
+// e.g. secret auth without WEBHOOK_SECRET or a secret of its own.
+func WarnWebhookAuth(ctx context.Context, profiles services.ProfileService, logger *slog.Logger) {
+	list, err := profiles.List(ctx)
+	if err != nil {
+		logger.Error("failed to check webhook auth", "error", err)
+		return
+	}
+
+	for i := range list {
+		if missing := missingAuthSettings(&list[i]); len(missing) > 0 {
+			logger.Warn("webhooks of the account will be rejected, its auth settings are empty",
+				"user_id", list[i].UserId,
+				"profile", list[i].ProfileName,
+				"methods", missing,
+			)
+		}
+	}
+}
+
+// WebhookAuthMiddleware runs every authentication method listed in the
+// webhook_auth setting of the account the message belongs to; all of them
+// must pass. Messages for unknown accounts are passed through, the webhook
+// handler acknowledges and drops them.
+func WebhookAuthMiddleware(profiles services.ProfileService, authenticators map[string]Authenticator, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+			if err != nil {
+				http.Error(w, "Bad request", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			msg, err := handlers_models.DecodeWebhook(body)
+			if err != nil {
+				// let the handler reply to malformed payloads
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			profile, err := profiles.Get(r.Context(), msg.UserId)
+			if errors.Is(err, services.ErrUnknownProfile) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				logger.Error("failed to resolve profile", "error", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			for _, method := range strings.Split(profile.WebhookAuth, ",") {
+				method = strings.TrimSpace(method)
+				if method == "" || method == "none" {
+					continue
+				}
+
+				err := fmt.Errorf("unknown auth method %q", method)
+				if auth, ok := authenticators[method]; ok {
+					err = auth.Authenticate(r, body, profile)
+				}
+
+				if err != nil {
+					rejectedWebhooks.Add(method, 1)
+					logger.Warn("webhook rejected",
+						"method", method,
+						"reason", err,
+						"user_id", msg.UserId,
+						"remote_addr", r.RemoteAddr,
+					)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
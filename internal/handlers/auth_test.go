@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mngn84/avito-cons/internal/services"
+	"github.com/mngn84/avito-cons/internal/storage"
+	"github.com/mngn84/avito-cons/internal/storage/memory"
+)
+
+const authTestBody = `{"id": "m1", "user_id": 1, "author_id": 2, "chat_id": "c1", "type": "text", "content": {"text": "hi"}}`
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    storage.Profile
+		trustProxy bool
+		body       string
+		path       string
+		header     map[string]string
+		remoteAddr string
+		want       int
+	}{
+		{
+			name:    "secret in header",
+			profile: storage.Profile{WebhookAuth: "secret", WebhookSecret: "s3cret"},
+			header:  map[string]string{"X-Webhook-Secret": "s3cret"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "secret in path",
+			profile: storage.Profile{WebhookAuth: "secret", WebhookSecret: "s3cret"},
+			path:    "/webhook/s3cret",
+			want:    http.StatusOK,
+		},
+		{
+			name:    "wrong secret",
+			profile: storage.Profile{WebhookAuth: "secret", WebhookSecret: "s3cret"},
+			header:  map[string]string{"X-Webhook-Secret": "guess"},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "missing secret",
+			profile: storage.Profile{WebhookAuth: "secret", WebhookSecret: "s3cret"},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "secret not configured",
+			profile: storage.Profile{WebhookAuth: "secret"},
+			header:  map[string]string{"X-Webhook-Secret": ""},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "hmac",
+			profile: storage.Profile{WebhookAuth: "hmac", WebhookSecret: "s3cret"},
+			header:  map[string]string{"X-Signature": sign("s3cret", authTestBody)},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "hmac with prefix",
+			profile: storage.Profile{WebhookAuth: "hmac", WebhookSecret: "s3cret"},
+			header:  map[string]string{"X-Signature": "sha256=" + sign("s3cret", authTestBody)},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "hmac of another secret",
+			profile: storage.Profile{WebhookAuth: "hmac", WebhookSecret: "s3cret"},
+			header:  map[string]string{"X-Signature": sign("other", authTestBody)},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "malformed hmac",
+			profile: storage.Profile{WebhookAuth: "hmac", WebhookSecret: "s3cret"},
+			header:  map[string]string{"X-Signature": "not hex"},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:       "ip",
+			profile:    storage.Profile{WebhookAuth: "ip", WebhookIPs: "10.0.0.1, 192.0.2.7"},
+			remoteAddr: "192.0.2.7:4000",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "ip in cidr",
+			profile:    storage.Profile{WebhookAuth: "ip", WebhookIPs: "192.0.2.0/24"},
+			remoteAddr: "192.0.2.7:4000",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "ip not allowed",
+			profile:    storage.Profile{WebhookAuth: "ip", WebhookIPs: "10.0.0.0/8"},
+			remoteAddr: "192.0.2.7:4000",
+			want:       http.StatusUnauthorized,
+		},
+		{
+			name:       "forwarded ip behind a trusted proxy",
+			profile:    storage.Profile{WebhookAuth: "ip", WebhookIPs: "10.0.0.1"},
+			trustProxy: true,
+			header:     map[string]string{"X-Forwarded-For": "10.0.0.1, 192.0.2.7"},
+			remoteAddr: "192.0.2.7:4000",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "forwarded ip is ignored without a trusted proxy",
+			profile:    storage.Profile{WebhookAuth: "ip", WebhookIPs: "10.0.0.1"},
+			header:     map[string]string{"X-Forwarded-For": "10.0.0.1"},
+			remoteAddr: "192.0.2.7:4000",
+			want:       http.StatusUnauthorized,
+		},
+		{
+			name:    "none",
+			profile: storage.Profile{WebhookAuth: "none"},
+			want:    http.StatusOK,
+		},
+		{
+			name:       "every method must pass",
+			profile:    storage.Profile{WebhookAuth: "secret, ip", WebhookSecret: "s3cret", WebhookIPs: "10.0.0.1"},
+			header:     map[string]string{"X-Webhook-Secret": "s3cret"},
+			remoteAddr: "192.0.2.7:4000",
+			want:       http.StatusUnauthorized,
+		},
+		{
+			name:    "unknown method",
+			profile: storage.Profile{WebhookAuth: "token", WebhookSecret: "s3cret"},
+			header:  map[string]string{"X-Webhook-Secret": "s3cret"},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			// the webhook handler acknowledges and drops it
+			name:    "unknown account",
+			profile: storage.Profile{WebhookAuth: "secret", WebhookSecret: "s3cret"},
+			body:    `{"id": "m1", "user_id": 999, "author_id": 2, "chat_id": "c1", "type": "text", "content": {"text": "hi"}}`,
+			want:    http.StatusOK,
+		},
+		{
+			name:    "malformed payload",
+			profile: storage.Profile{WebhookAuth: "secret", WebhookSecret: "s3cret"},
+			body:    `{"id":`,
+			want:    http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Webhook.TrustProxy = tt.trustProxy
+			db := memory.NewStore()
+			tt.profile.UserId = 1
+			db.SaveProfile(tt.profile)
+			profiles := services.NewProfileService(cfg, testLogger(), db)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			// grouped as in main, so the path secret is routed before auth
+			router := chi.NewRouter()
+			router.Group(func(r chi.Router) {
+				r.Use(WebhookAuthMiddleware(profiles, NewAuthenticators(cfg), testLogger()))
+				r.Post("/webhook", next)
+				r.Post("/webhook/{secret}", next)
+			})
+
+			body, path := tt.body, tt.path
+			if body == "" {
+				body = authTestBody
+			}
+			if path == "" {
+				path = "/webhook"
+			}
+			r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			for key, value := range tt.header {
+				r.Header.Set(key, value)
+			}
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingAuthSettings(t *testing.T) {
+	tests := []struct {
+		profile storage.Profile
+		want    []string
+	}{
+		{storage.Profile{WebhookAuth: "secret", WebhookSecret: "s3cret"}, []string{}},
+		{storage.Profile{WebhookAuth: "secret, hmac"}, []string{"secret", "hmac"}},
+		{storage.Profile{WebhookAuth: "ip", WebhookIPs: " "}, []string{"ip"}},
+		{storage.Profile{WebhookAuth: "ip", WebhookIPs: "10.0.0.1"}, []string{}},
+		{storage.Profile{WebhookAuth: "none"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := missingAuthSettings(&tt.profile); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("missingAuthSettings(%q) = %v, want %v", tt.profile.WebhookAuth, got, tt.want)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/storage"
 )
 
 func HealthCheckHandler() http.HandlerFunc {
@@ -12,3 +17,23 @@ func HealthCheckHandler() http.HandlerFunc {
 		json.NewEncoder(w).Encode(map[string]bool{"ok": true})
 	}
 }
+
+// ReadinessHandler reports 503 while the database is unreachable, so the
+// instance is taken out of rotation instead of failing webhooks. The error is
+// only logged, it may name the database host and user.
+func ReadinessHandler(db storage.Pinger, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := db.Ping(ctx); err != nil {
+			logger.Error("readiness check failed", "error", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]bool{"ok": false})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+	}
+}
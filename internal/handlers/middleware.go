@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 func MethodMiddleware(allowedMethod string) func(http.Handler) http.Handler {
@@ -14,4 +19,25 @@ func MethodMiddleware(allowedMethod string) func(http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 		})
 	}
-}
\ No newline at end of file
+}
+
+// RequestLogger is chi's request log with the secret of /webhook/{secret}
+// masked, it authenticates the webhook.
+func RequestLogger() func(http.Handler) http.Handler {
+	return middleware.RequestLogger(&redactingFormatter{
+		LogFormatter: &middleware.DefaultLogFormatter{Logger: log.New(os.Stdout, "", log.LstdFlags)},
+	})
+}
+
+type redactingFormatter struct {
+	middleware.LogFormatter
+}
+
+func (f *redactingFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	if strings.HasPrefix(r.URL.Path, "/webhook/") {
+		masked := *r
+		masked.RequestURI = "/webhook/***"
+		return f.LogFormatter.NewLogEntry(&masked)
+	}
+	return f.LogFormatter.NewLogEntry(r)
+}
@@ -1,49 +1,156 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 
 	"github.com/mngn84/avito-cons/internal/models/handlers_models"
 	"github.com/mngn84/avito-cons/internal/services"
+	"github.com/mngn84/avito-cons/internal/storage"
 )
 
+var droppedWebhooks = expvar.NewMap("webhook_dropped")
+
 type WebhookHandler interface {
-	HandleAvitoMsg(msg *handlers_models.FromAvitoMsg) (string, error) //error
+	HandleAvitoMsg(ctx context.Context, msg *handlers_models.FromAvitoMsg) error
 	ServerHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 type webhookHandler struct {
-	avito  services.AvitoService
-	openai services.OpenAIService
-	logger *slog.Logger
+	avito      services.AvitoService
+	openai     services.OpenAIService
+	delivery   services.DeliveryService
+	voice      services.VoiceService
+	handoff    services.HandoffService
+	escalation services.EscalationService
+	history    services.HistoryService
+	queue      services.QueueService
+	profiles   services.ProfileService
+	logger     *slog.Logger
 }
 
-func NewWebhookHandler(avito services.AvitoService, openai services.OpenAIService, logger *slog.Logger) WebhookHandler {
+func NewWebhookHandler(avito services.AvitoService, openai services.OpenAIService, delivery services.DeliveryService, voice services.VoiceService, handoff services.HandoffService, escalation services.EscalationService, history services.HistoryService, queue services.QueueService, profiles services.ProfileService, logger *slog.Logger) WebhookHandler {
 	return &webhookHandler{
-		avito:  avito,
-		openai: openai,
-		logger: logger,
+		avito:      avito,
+		openai:     openai,
+		delivery:   delivery,
+		voice:      voice,
+		handoff:    handoff,
+		escalation: escalation,
+		history:    history,
+		queue:      queue,
+		profiles:   profiles,
+		logger:     logger,
 	}
 }
 
-func (h *webhookHandler) HandleAvitoMsg(msg *handlers_models.FromAvitoMsg) (string, error) {
+func (h *webhookHandler) HandleAvitoMsg(ctx context.Context, msg *handlers_models.FromAvitoMsg) error {
 	h.logger.Info("processing message", "msg", msg)
 
-	itemInfo, err := h.avito.GetItemInfo(msg.UserId, msg.ChatId)
+	profile, err := h.profiles.Get(ctx, msg.UserId)
+	if errors.Is(err, services.ErrUnknownProfile) {
+		h.logger.Info("message for unknown account, skipping", "user_id", msg.UserId)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// a retry after a send that failed midway would answer twice
+	if replied, err := h.delivery.Replied(ctx, msg); err != nil {
+		return err
+	} else if replied {
+		h.logger.Info("message already answered, skipping", "msg_id", msg.Id, "chat_id", msg.ChatId)
+		return nil
+	}
+
+	text := msg.Content.Text
+	if handlers_models.MsgType(msg.Type) == handlers_models.VoiceMsg {
+		text, err = h.voice.Transcript(ctx, msg)
+		if err != nil {
+			return fmt.Errorf("failed to transcribe voice: %w", err)
+		}
+	}
+
+	// stored even when the bot stays silent, for the audit
+	if err := h.history.SaveInbound(ctx, msg, text); err != nil {
+		return err
+	}
+
+	if active, err := h.handoff.IsActive(ctx, msg.UserId, msg.ChatId); err != nil {
+		return err
+	} else if !active {
+		h.logger.Info("bot is paused in chat, skipping", "chat_id", msg.ChatId)
+		return nil
+	}
+
+	itemInfo, err := h.avito.GetItemInfo(ctx, msg.UserId, msg.ChatId)
 	if err != nil {
 		h.logger.Error("failed to get item info", "error", err)
 	}
 
-	res, err := h.openai.GetResponse(msg.Content.Text, msg.ChatId, msg.UserId, msg.Created, itemInfo.Context.Value)
+	images := [][]byte{}
+	if handlers_models.MsgType(msg.Type) == handlers_models.ImageMsg {
+		if msg.Content.Image == nil {
+			return fmt.Errorf("message %s has no image content", msg.Id)
+		}
+		image, err := h.avito.DownloadImage(ctx, msg.Content.Image.LargestUrl())
+		if err != nil {
+			return fmt.Errorf("failed to download image: %w", err)
+		}
+		images = append(images, image)
+	}
+
+	res, err := h.openai.GetResponse(ctx, profile, text, images, msg.ChatId, msg.Id, itemInfo.Context.Value)
 
 	if err != nil {
-		return "", fmt.Errorf("failed to get response: %w", err) //fmt.Errorf("failed to get response: %w", err)
+		return fmt.Errorf("failed to get response: %w", err)
+	}
+
+	avitoMsgId, err := h.reply(ctx, profile, msg, res)
+
+	// every generated reply is kept for its run and usage, also when it was
+	// dropped or saved as a draft; a failure here must not retry the job
+	if res.Text != "" {
+		if err := h.history.SaveReply(context.WithoutCancel(ctx), msg, res, avitoMsgId); err != nil {
+			h.logger.Error("failed to save reply", "error", err, "chat_id", msg.ChatId)
+		}
 	}
 
-	return res, nil //h.avito.SendMessage(msg.UserId, msg.ChatId, res)
+	return err
+}
+
+// reply escalates the chat when asked to and delivers the text, unless a
+// manager has taken over. It returns the Avito id of the sent message.
+func (h *webhookHandler) reply(ctx context.Context, profile *storage.Profile, msg *handlers_models.FromAvitoMsg, res services.Response) (string, error) {
+	if res.Escalation != nil {
+		if err := h.escalation.Escalate(ctx, profile, msg, res.Escalation); err != nil {
+			return "", fmt.Errorf("failed to escalate: %w", err)
+		}
+	} else if active, err := h.handoff.IsActive(ctx, msg.UserId, msg.ChatId); err != nil {
+		return "", err
+	} else if !active {
+		// a manager has taken over while the assistant was running
+		h.logger.Info("bot was paused in chat, dropping reply", "chat_id", msg.ChatId)
+		return "", nil
+	}
+
+	if res.Text == "" {
+		return "", nil
+	}
+
+	avitoMsgId, err := h.delivery.Deliver(ctx, profile, msg, res.Text)
+	if err != nil {
+		return "", fmt.Errorf("failed to deliver response: %w", err)
+	}
+
+	return avitoMsgId, nil
 }
 
 func (h *webhookHandler) ServerHTTP(w http.ResponseWriter, r *http.Request) {
@@ -54,39 +161,82 @@ func (h *webhookHandler) ServerHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg := handlers_models.FromAvitoMsg{}
-	decoder := json.NewDecoder(r.Body)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.logger.Error("failed to read request body", "error", err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
 
-	if err := decoder.Decode(&msg); err != nil {
+	msg, err := handlers_models.DecodeWebhook(body)
+	if errors.Is(err, handlers_models.ErrUnsupportedPayload) {
+		h.logger.Info("not a message event, skipping processing", "error", err)
+		h.writeOk(w)
+		return
+	}
+	if errors.Is(err, handlers_models.ErrUnsupportedVersion) {
+		// acknowledged, an error would only make Avito redeliver it
+		droppedWebhooks.Add("unsupported_version", 1)
+		h.logger.Warn("unsupported webhook version, dropping", "error", err)
+		h.writeOk(w)
+		return
+	}
+	if err != nil {
 		h.logger.Error("failed to decode request body", "error", err)
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	if msg.AuthorId == 0 || msg.ChatId == "" {
+	if msg.ChatId == "" {
 		h.logger.Info("Invalid message received, skipping processing", "msg", msg)
 		http.Error(w, "Invalid message data", http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	// Обрабатываем сообщение сразу (без горутины)
-	resText, err := h.HandleAvitoMsg(&msg)
-	if err != nil {
-		h.logger.Error("failed to handle avito message", "error", err)
+	// before anything is changed: the auth middleware lets messages of
+	// unknown accounts through unauthenticated
+	if _, err := h.profiles.Get(r.Context(), msg.UserId); err != nil {
+		if !errors.Is(err, services.ErrUnknownProfile) {
+			h.logger.Error("failed to resolve profile", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		// acknowledge so that Avito does not keep redelivering it
+		h.logger.Info("message for unknown account, skipping", "user_id", msg.UserId)
+		h.writeOk(w)
+		return
+	}
+
+	class := services.ClassifyMessage(msg)
+	if class == services.MsgFromAccount {
+		if err := h.handoff.ObserveOwnMessage(r.Context(), msg); err != nil {
+			h.logger.Error("failed to update chat state", "error", err, "chat_id", msg.ChatId)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if class != services.MsgFromCustomer {
+		h.logger.Info("not a customer message, skipping processing", "class", class, "type", msg.Type, "chat_id", msg.ChatId)
+		h.writeOk(w)
+		return
+	}
+
+	if err := h.queue.Enqueue(r.Context(), msg); err != nil {
+		if errors.Is(err, services.ErrDuplicateMessage) {
+			h.logger.Info("duplicate message, skipping processing", "msg_id", msg.Id, "chat_id", msg.ChatId)
+			h.writeOk(w)
+			return
+		}
+		h.logger.Error("failed to enqueue avito message", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// Отправляем ответ с текстом
+	h.writeOk(w)
+}
+
+func (h *webhookHandler) writeOk(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"response": resText})
-
-	// go func() { // можно убрать после реализации очереди
-	// 	if err := h.HandleAvitoMsg(&msg); err != nil {
-	// 		h.logger.Error("failed to handle avito message", "error", err)
-	// 	}
-	// }()
-
+	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/services"
+	"github.com/mngn84/avito-cons/internal/storage"
+	"github.com/mngn84/avito-cons/internal/storage/memory"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		Webhook: config.WebhookConfig{
+			Auth:            "secret",
+			SecretHeader:    "X-Webhook-Secret",
+			SignatureHeader: "X-Signature",
+		},
+		Handoff: config.HandoffConfig{PauseTTL: time.Hour},
+		Queue:   config.QueueConfig{MaxAttempts: 3},
+	}
+}
+
+func newTestWebhook(cfg *config.Config, db *memory.Store) (http.Handler, services.HandoffService) {
+	logger := testLogger()
+	profiles := services.NewProfileService(cfg, logger, db)
+	handoff := services.NewHandoffService(cfg, logger, db)
+	queue := services.NewQueueService(cfg, logger, db)
+
+	h := NewWebhookHandler(nil, nil, nil, nil, handoff, nil, nil, queue, profiles, logger)
+	auth := WebhookAuthMiddleware(profiles, NewAuthenticators(cfg), logger)
+
+	return auth(http.HandlerFunc(h.ServerHTTP)), handoff
+}
+
+func postWebhook(handler http.Handler, body string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		r.Header[key] = values
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestWebhookUnknownAccountCannotPauseChat(t *testing.T) {
+	db := memory.NewStore()
+	db.SaveProfile(storage.Profile{UserId: 1, WebhookSecret: "s3cret"})
+	handler, handoff := newTestWebhook(testConfig(), db)
+
+	// unauthenticated: the middleware only knows the secret of account 1
+	body := `{"id": "a1", "user_id": 999, "author_id": 999, "chat_id": "c1", "type": "text", "content": {"text": "hi"}}`
+	if w := postWebhook(handler, body, nil); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want an acknowledged drop", w.Code)
+	}
+
+	for _, userId := range []int{1, 999} {
+		if active, err := handoff.IsActive(context.Background(), userId, "c1"); err != nil || !active {
+			t.Fatalf("IsActive(%d) = %t, %v, want true", userId, active, err)
+		}
+	}
+}
+
+func TestWebhookManagerReplyPausesChat(t *testing.T) {
+	db := memory.NewStore()
+	db.SaveProfile(storage.Profile{UserId: 1, WebhookSecret: "s3cret"})
+	handler, handoff := newTestWebhook(testConfig(), db)
+
+	body := `{"id": "a1", "user_id": 1, "author_id": 1, "chat_id": "c1", "type": "text", "content": {"text": "manager here"}}`
+	if w := postWebhook(handler, body, http.Header{"X-Webhook-Secret": {"s3cret"}}); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	if active, err := handoff.IsActive(context.Background(), 1, "c1"); err != nil || active {
+		t.Fatalf("IsActive = %t, %v, want the chat paused", active, err)
+	}
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,35 +11,61 @@ import (
 	"time"
 )
 
+// DefaultMaxBodySize caps the responses read by a Client unless changed with
+// WithMaxBodySize.
+const DefaultMaxBodySize = 10 << 20
+
+var ErrBodyTooLarge = errors.New("response body is too large")
+
 type RetryConfig struct {
 	MaxRetries int
 	BaseDelay  time.Duration
 	MaxDelay   time.Duration
 }
 
+// StatusError is returned when the server answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
 type Client struct {
-	client *http.Client
-	logger *slog.Logger
-	config RetryConfig
+	client  *http.Client
+	logger  *slog.Logger
+	config  RetryConfig
+	maxBody int64
 }
 
 func NewClient(client *http.Client, logger *slog.Logger, config RetryConfig) *Client {
 	return &Client{
-		client: client,
-		logger: logger,
-		config: config,
+		client:  client,
+		logger:  logger,
+		config:  config,
+		maxBody: DefaultMaxBodySize,
 	}
 }
 
+// WithMaxBodySize returns a copy of the client that reads responses of up to
+// n bytes.
+func (c *Client) WithMaxBodySize(n int64) *Client {
+	clone := *c
+	clone.maxBody = n
+	return &clone
+}
+
 func (c *Client) Do(ctx context.Context, req *http.Request) ([]byte, error) {
 	if c.logger != nil {
 		c.logger.Info("DO: sending request")
 	}
 
-	return doRequest(ctx, c.client, req, c.logger, c.config)
+	return doRequest(ctx, c.client, req, c.logger, c.config, c.maxBody)
 }
 
-func doRequest(ctx context.Context, client *http.Client, req *http.Request, logger *slog.Logger, cfg RetryConfig) ([]byte, error) {
+func doRequest(ctx context.Context, client *http.Client, req *http.Request, logger *slog.Logger, cfg RetryConfig, maxBody int64) ([]byte, error) {
     var lastErr error
     if logger != nil {
         logger.Info("DOrequest: sending request", "url", req.URL.String(), "method", req.Method)
@@ -57,6 +84,14 @@ func doRequest(ctx context.Context, client *http.Client, req *http.Request, logg
                 logger.Debug("sending request", "attempt", i+1)
             }
 
+            if i > 0 && req.GetBody != nil {
+                reqBody, err := req.GetBody()
+                if err != nil {
+                    return nil, fmt.Errorf("failed to reset request body: %w", err)
+                }
+                req.Body = reqBody
+            }
+
             res, err := client.Do(req.WithContext(ctx))
             if err != nil {
                 lastErr = fmt.Errorf("failed to send request: %w", err)
@@ -84,11 +119,14 @@ func doRequest(ctx context.Context, client *http.Client, req *http.Request, logg
             }
             defer res.Body.Close()
 
-            body, err := io.ReadAll(res.Body)
+            body, err := io.ReadAll(io.LimitReader(res.Body, maxBody+1))
             if err != nil {
                 lastErr = fmt.Errorf("failed to read response body: %w", err)
                 continue
             }
+            if int64(len(body)) > maxBody {
+                return nil, fmt.Errorf("%w: over %d bytes", ErrBodyTooLarge, maxBody)
+            }
 
             // Логируем статус и тело ответа
             if logger != nil {
@@ -96,10 +134,14 @@ func doRequest(ctx context.Context, client *http.Client, req *http.Request, logg
             }
 
             if res.StatusCode != http.StatusOK {
+                lastErr = &StatusError{StatusCode: res.StatusCode, Body: string(body)}
                 if logger != nil {
                     logger.Error("request failed", "attempt", i+1, "status", res.StatusCode, "error", lastErr)
                 }
-                lastErr = fmt.Errorf("unexpected status code %d: %s", res.StatusCode, string(body))
+                // client errors will not go away on retry
+                if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+                    return nil, lastErr
+                }
                 continue
             }
 
@@ -110,7 +152,7 @@ func doRequest(ctx context.Context, client *http.Client, req *http.Request, logg
         }
     }
 
-    if lastErr != nil {
+    if lastErr == nil {
         return nil, fmt.Errorf("max retries exceeded, but no specific error was recorded")
     }
     return nil, fmt.Errorf("max retries exceeded: %w", lastErr)
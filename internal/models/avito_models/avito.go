@@ -64,4 +64,43 @@ type Context struct {
 
 type GetChatInfoResponse struct{
 	Context Context `json:"context"`
-}
\ No newline at end of file
+}
+
+// tokenResponse
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+// webhook subscriptions
+type WebhookRequest struct {
+	Url string `json:"url"`
+}
+
+type Subscription struct {
+	Url     string `json:"url"`
+	Version string `json:"version"`
+}
+
+type OkResponse struct {
+	Ok OK `json:"ok"`
+}
+
+type SubscriptionsResponse struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// getVoiceFilesResponse
+type VoiceFilesResponse struct {
+	VoicesUrls map[string]string `json:"voices_urls"`
+}
+
+// getItemInfoResponse
+type ItemInfoResponse struct {
+	AutoloadItemId string `json:"autoload_item_id"`
+	FinishTime     string `json:"finish_time"`
+	StartTime      string `json:"start_time"`
+	Status         string `json:"status"`
+	Url            string `json:"url"`
+}
@@ -1,5 +1,10 @@
 package handlers_models
 
+import (
+	"strconv"
+	"strings"
+)
+
 type MsgType string
 
 const (
@@ -25,7 +30,91 @@ const (
 )
 
 type MsgContent struct {
+	Text string `json:"text,omitempty"`
+	Image *ImageContent `json:"image,omitempty"`
+	Item *ItemContent `json:"item,omitempty"`
+	Link *LinkContent `json:"link,omitempty"`
+	Location *LocationContent `json:"location,omitempty"`
+	Voice *VoiceContent `json:"voice,omitempty"`
+	File *FileContent `json:"file,omitempty"`
+	Video *VideoContent `json:"video,omitempty"`
+	Call *CallContent `json:"call,omitempty"`
+}
+
+// sizes are keyed by resolution, e.g. "1280x960"
+type ImageContent struct {
+	Sizes map[string]string `json:"sizes"`
+}
+
+// LargestUrl returns the url of the size with the most pixels. Keys that are
+// not a resolution are only used when nothing else is available.
+func (c *ImageContent) LargestUrl() string {
+	largest, best := "", -1
+	for size, url := range c.Sizes {
+		if url == "" {
+			continue
+		}
+		area := 0
+		if w, h, ok := strings.Cut(size, "x"); ok {
+			width, _ := strconv.Atoi(w)
+			height, _ := strconv.Atoi(h)
+			area = width * height
+		}
+		if area > best || (area == best && url < largest) {
+			largest, best = url, area
+		}
+	}
+	return largest
+}
+
+type ItemContent struct {
+	ImageUrl string `json:"image_url"`
+	ItemUrl string `json:"item_url"`
+	PriceString string `json:"price_string"`
+	Title string `json:"title"`
+}
+
+type LinkPreview struct {
+	Description string `json:"description"`
+	Domain string `json:"domain"`
+	Images map[string]string `json:"images"`
+	Title string `json:"title"`
+	Url string `json:"url"`
+}
+
+type LinkContent struct {
 	Text string `json:"text"`
+	Url string `json:"url"`
+	Preview *LinkPreview `json:"preview,omitempty"`
+}
+
+type LocationContent struct {
+	Kind string `json:"kind"`
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+	Text string `json:"text"`
+	Title string `json:"title"`
+}
+
+type VoiceContent struct {
+	VoiceId string `json:"voice_id"`
+}
+
+type FileContent struct {
+	FileId string `json:"file_id"`
+	Name string `json:"name"`
+	Size int64 `json:"size"`
+	Url string `json:"url"`
+}
+
+type VideoContent struct {
+	VideoId string `json:"video_id"`
+	Url string `json:"url"`
+}
+
+type CallContent struct {
+	Status string `json:"status"`
+	TargetUserId int `json:"target_user_id"`
 }
 
 type FromAvitoMsg struct {
@@ -36,6 +125,7 @@ type FromAvitoMsg struct {
 	Created int `json:"created"`
 	Id string `json:"id"`
 	ItemId *int `json:"item_id"`
+	PublishedAt string `json:"published_at,omitempty"`
 	Read *int `json:"read"`
 	Type string `json:"type"`
 	UserId int `json:"user_id"`
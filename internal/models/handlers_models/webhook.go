@@ -0,0 +1,62 @@
+package handlers_models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	WebhookVersion     = "v3"
+	MessagePayloadType = "message"
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported webhook version")
+	ErrUnsupportedPayload = errors.New("unsupported webhook payload")
+)
+
+type WebhookPayload struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type WebhookEnvelope struct {
+	Id        string          `json:"id"`
+	Version   string          `json:"version"`
+	Timestamp int64           `json:"timestamp"`
+	Payload   *WebhookPayload `json:"payload"`
+}
+
+// DecodeWebhook accepts the messenger webhook envelope
+// {id, version, timestamp, payload: {type, value}} as well as a bare message
+// in the flat legacy shape, and returns the message.
+func DecodeWebhook(data []byte) (*FromAvitoMsg, error) {
+	envelope := WebhookEnvelope{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	msg := FromAvitoMsg{}
+
+	if envelope.Payload == nil {
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, err
+		}
+		return &msg, nil
+	}
+
+	if envelope.Version != WebhookVersion && !strings.HasPrefix(envelope.Version, WebhookVersion+".") {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedVersion, envelope.Version)
+	}
+	if envelope.Payload.Type != MessagePayloadType {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedPayload, envelope.Payload.Type)
+	}
+
+	if err := json.Unmarshal(envelope.Payload.Value, &msg); err != nil {
+		return nil, fmt.Errorf("failed to decode message: %w", err)
+	}
+
+	return &msg, nil
+}
@@ -1 +1,44 @@
-package openai_models
\ No newline at end of file
+package openai_models
+
+// createMessageRequest with content parts; go-openai only sends plain text
+type ImageFile struct {
+	FileId string `json:"file_id"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type ContentPart struct {
+	Type      string     `json:"type"`
+	Text      string     `json:"text,omitempty"`
+	ImageFile *ImageFile `json:"image_file,omitempty"`
+}
+
+type MessageRequest struct {
+	Role    string        `json:"role"`
+	Content []ContentPart `json:"content"`
+}
+
+// thread.message.delta stream event
+type TextDelta struct {
+	Value string `json:"value"`
+}
+
+type ContentDelta struct {
+	Index int        `json:"index"`
+	Type  string     `json:"type"`
+	Text  *TextDelta `json:"text,omitempty"`
+}
+
+type MessageDelta struct {
+	Content []ContentDelta `json:"content"`
+}
+
+type MessageDeltaEvent struct {
+	Id    string       `json:"id"`
+	Delta MessageDelta `json:"delta"`
+}
+
+// error stream event
+type StreamError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -6,8 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	stdhttp "net/http"
+	neturl "net/url"
+	"strings"
 	"time"
 
 	"github.com/mngn84/avito-cons/internal/config"
@@ -16,18 +19,33 @@ import (
 )
 
 type AvitoService interface {
-	SendMessage(userId int, chatId string, text string) error
-	ReadChat(userId int, chatId string) error
-	GetItemInfo(userId int, chatId string) (avito_models.GetChatInfoResponse, error)
+	SendMessage(ctx context.Context, userId int, chatId string, text string) (avito_models.SendMsgResponse, error)
+	ReadChat(ctx context.Context, userId int, chatId string) error
+	GetItemInfo(ctx context.Context, userId int, chatId string) (avito_models.GetChatInfoResponse, error)
+	Subscribe(ctx context.Context, userId int, webhookUrl string) error
+	Unsubscribe(ctx context.Context, userId int, webhookUrl string) error
+	ListSubscriptions(ctx context.Context, userId int) ([]avito_models.Subscription, error)
+	DownloadImage(ctx context.Context, url string) ([]byte, error)
+	DownloadVoice(ctx context.Context, userId int, voiceId string) ([]byte, error)
+	GetItem(ctx context.Context, userId int, itemId int) (avito_models.ItemInfoResponse, error)
 }
 
+// images and voice messages larger than this are not downloaded; it is the
+// upload limit of the transcription API
+const maxFileSize = 25 << 20
+
 type avitoService struct {
 	client *http.Client
+	// sends are not idempotent: a retry after a timeout could post the
+	// message twice, so they get a single attempt
+	send   *http.Client
+	files  *http.Client
 	config *config.Config
 	logger *slog.Logger
+	tokens TokenProvider
 }
 
-func NewAvitoService(config *config.Config, logger *slog.Logger) AvitoService {
+func NewAvitoService(config *config.Config, logger *slog.Logger, tokens TokenProvider) AvitoService {
 	httpClient := &stdhttp.Client{
 		Timeout: 10 * time.Second,
 	}
@@ -42,15 +60,16 @@ func NewAvitoService(config *config.Config, logger *slog.Logger) AvitoService {
 
 	return &avitoService{
 		client: customClient,
+		send:   http.NewClient(httpClient, logger, http.RetryConfig{MaxRetries: 1}),
+		// no logger: the client logs response bodies, which are binary here
+		files:  http.NewClient(httpClient, nil, retryConfig).WithMaxBodySize(maxFileSize),
 		config: config,
 		logger: logger,
+		tokens: tokens,
 	}
 }
 
-
-func (s *avitoService) SendMessage(userId int, chatId string, text string) error {
-	ctx := context.Background()
-
+func (s *avitoService) SendMessage(ctx context.Context, userId int, chatId string, text string) (avito_models.SendMsgResponse, error) {
 	msg := avito_models.ToAvitoMsg{
 		Message: avito_models.Msg{
 			Text: text,
@@ -60,94 +79,239 @@ func (s *avitoService) SendMessage(userId int, chatId string, text string) error
 
 	jsonData, err := json.Marshal(msg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal json: %w", err)
+		return avito_models.SendMsgResponse{}, fmt.Errorf("failed to marshal json: %w", err)
 	}
 
 	url := fmt.Sprintf("%s/messenger/v1/accounts/%d/chats/%s/messages", s.config.Avito.ApiUrl, userId, chatId)
 
-	req, err := stdhttp.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	body, err := s.doWith(ctx, s.send, userId, "POST", url, jsonData)
 	if err != nil {
-		return err
+		if s.logger != nil {
+			s.logger.Error("failed to send request", "error", err)
+		}
+		return avito_models.SendMsgResponse{}, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.config.Avito.Token))
+	res := avito_models.SendMsgResponse{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		if s.logger != nil {
+			s.logger.Error("failed to unmarshal response", "error", err)
+		}
+		return avito_models.SendMsgResponse{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return res, nil
+}
 
-	body, err := s.client.Do(ctx, req)
+func (s *avitoService) ReadChat(ctx context.Context, userId int, chatId string) error {
+	url := fmt.Sprintf("%s/messenger/v1/accounts/%d/chats/%s/read", s.config.Avito.ApiUrl, userId, chatId)
+
+	body, err := s.do(ctx, userId, "POST", url, nil)
 	if err != nil {
-		if s.logger != nil {
-            s.logger.Error("failed to send request", "error", err)
-        }
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 
-	res := avito_models.SendMsgResponse{}
+	var res avito_models.ReadChatResponse
 	if err := json.Unmarshal(body, &res); err != nil {
-		if s.logger != nil {
-            s.logger.Error("failed to unmarshal response", "error", err)
-        }
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	return nil
 }
 
-func (s *avitoService) ReadChat(userId int, chatId string) error {
-	ctx := context.Background()
+func (s *avitoService) GetItemInfo(ctx context.Context, userId int, chatId string) (avito_models.GetChatInfoResponse, error) {
+	url := fmt.Sprintf("%s/messenger/v2/accounts/%d/chats/%s", s.config.Avito.ApiUrl, userId, chatId)
 
-	url := fmt.Sprintf("%s/messenger/v1/accounts/%d/chats/%s/read", s.config.Avito.ApiUrl, userId, chatId)
+	body, err := s.do(ctx, userId, "GET", url, nil)
+	if err != nil {
+		return avito_models.GetChatInfoResponse{}, fmt.Errorf("failed to send request: %w", err)
+	}
 
-	req, err := stdhttp.NewRequestWithContext(ctx, "POST", url, nil)
+	if body == nil {
+		return avito_models.GetChatInfoResponse{}, errors.New("response body is nil")
+	}
+
+	res := avito_models.GetChatInfoResponse{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return avito_models.GetChatInfoResponse{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return res, nil
+}
+
+func (s *avitoService) GetItem(ctx context.Context, userId int, itemId int) (avito_models.ItemInfoResponse, error) {
+	url := fmt.Sprintf("%s/core/v1/accounts/%d/items/%d/", s.config.Avito.ApiUrl, userId, itemId)
+
+	body, err := s.do(ctx, userId, "GET", url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return avito_models.ItemInfoResponse{}, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.config.Avito.Token))
+	res := avito_models.ItemInfoResponse{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return avito_models.ItemInfoResponse{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return res, nil
+}
+
+func (s *avitoService) Subscribe(ctx context.Context, userId int, webhookUrl string) error {
+	url := fmt.Sprintf("%s/messenger/v3/webhook", s.config.Avito.ApiUrl)
+	return s.postWebhook(ctx, userId, url, webhookUrl)
+}
+
+func (s *avitoService) Unsubscribe(ctx context.Context, userId int, webhookUrl string) error {
+	url := fmt.Sprintf("%s/messenger/v1/webhook/unsubscribe", s.config.Avito.ApiUrl)
+	return s.postWebhook(ctx, userId, url, webhookUrl)
+}
+
+func (s *avitoService) ListSubscriptions(ctx context.Context, userId int) ([]avito_models.Subscription, error) {
+	url := fmt.Sprintf("%s/messenger/v1/subscriptions", s.config.Avito.ApiUrl)
+
+	body, err := s.do(ctx, userId, "POST", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	res := avito_models.SubscriptionsResponse{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return res.Subscriptions, nil
+}
 
-	body, err := s.client.Do(ctx, req)
+func (s *avitoService) postWebhook(ctx context.Context, userId int, url, webhookUrl string) error {
+	jsonData, err := json.Marshal(avito_models.WebhookRequest{Url: webhookUrl})
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+
+	body, err := s.do(ctx, userId, "POST", url, jsonData)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 
-	var res avito_models.ReadChatResponse
+	var res avito_models.OkResponse
 	if err := json.Unmarshal(body, &res); err != nil {
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
+	if res.Ok != avito_models.Ok {
+		return errors.New("avito did not confirm the request")
+	}
 
 	return nil
 }
 
+// DownloadImage fetches a picture attached to a message. Image urls from the
+// webhook point to the Avito CDN and need no authorization; since the webhook
+// body is untrusted, other hosts are refused.
+func (s *avitoService) DownloadImage(ctx context.Context, url string) ([]byte, error) {
+	if !s.isImageHost(url) {
+		return nil, fmt.Errorf("image url %q is not on an Avito host", url)
+	}
+
+	req, err := stdhttp.NewRequestWithContext(ctx, "GET", url, stdhttp.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	body, err := s.files.Do(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
 
-func (s *avitoService) GetItemInfo(userId int, chatId string) (avito_models.GetChatInfoResponse, error) {
-    ctx := context.Background()
-    url := fmt.Sprintf("%s/messenger/v2/accounts/%d/chats/%s", s.config.Avito.ApiUrl, userId, chatId)
+	return body, nil
+}
 
-    req, err := stdhttp.NewRequestWithContext(ctx, "GET", url, stdhttp.NoBody)
-    if err != nil {
-        return avito_models.GetChatInfoResponse{}, fmt.Errorf("failed to create request: %w", err)
-    }
+func (s *avitoService) isImageHost(rawUrl string) bool {
+	u, err := neturl.Parse(rawUrl)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
 
-    req.Header.Set("Content-Type", "application/json")
-    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.config.Avito.Token))
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range strings.Split(s.config.Avito.ImageHosts, ",") {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed != "" && (host == allowed || strings.HasSuffix(host, "."+allowed)) {
+			return true
+		}
+	}
+	return false
+}
 
-    // s.logger.Info("GetItemInfo", "method", req.Method, "url", req.URL.String(), "headers", req.Header)
+// DownloadVoice resolves the temporary url of a voice message and fetches
+// the audio from it.
+func (s *avitoService) DownloadVoice(ctx context.Context, userId int, voiceId string) ([]byte, error) {
+	url := fmt.Sprintf("%s/messenger/v1/accounts/%d/getVoiceFiles?voice_ids=%s", s.config.Avito.ApiUrl, userId, neturl.QueryEscape(voiceId))
 
-    body, err := s.client.Do(ctx, req)
-    if err != nil {
-        // s.logger.Error("GetItemInfo", "failed to send request", err)
-        return avito_models.GetChatInfoResponse{}, fmt.Errorf("failed to send request: %w", err)
-    }
+	body, err := s.do(ctx, userId, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
 
-    if body == nil {
-        // s.logger.Error("Ошибка: body == nil")
-        return avito_models.GetChatInfoResponse{}, errors.New("response body is nil")
-    }
+	res := avito_models.VoiceFilesResponse{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
 
-    res := avito_models.GetChatInfoResponse{}
-    if err := json.Unmarshal(body, &res); err != nil {
-        return avito_models.GetChatInfoResponse{}, fmt.Errorf("failed to unmarshal response: %w", err)
-    }
+	voiceUrl := res.VoicesUrls[voiceId]
+	if voiceUrl == "" {
+		return nil, fmt.Errorf("no url for voice %s", voiceId)
+	}
 
-    return res, nil
-}
\ No newline at end of file
+	req, err := stdhttp.NewRequestWithContext(ctx, "GET", voiceUrl, stdhttp.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	audio, err := s.files.Do(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download voice: %w", err)
+	}
+
+	return audio, nil
+}
+
+// do sends an authorized, retried request on behalf of the account.
+func (s *avitoService) do(ctx context.Context, userId int, method, url string, payload []byte) ([]byte, error) {
+	return s.doWith(ctx, s.client, userId, method, url, payload)
+}
+
+// doWith sends the request with the given client. A 401 means the cached
+// token was revoked or expired early, so it is dropped and the request is
+// repeated once with a fresh one; the rejected request did nothing.
+func (s *avitoService) doWith(ctx context.Context, client *http.Client, userId int, method, url string, payload []byte) ([]byte, error) {
+	body, err := s.doOnce(ctx, client, userId, method, url, payload)
+
+	statusErr := &http.StatusError{}
+	if errors.As(err, &statusErr) && statusErr.StatusCode == stdhttp.StatusUnauthorized {
+		s.logger.Info("avito token rejected, refreshing", "user_id", userId)
+		s.tokens.Invalidate(userId)
+		return s.doOnce(ctx, client, userId, method, url, payload)
+	}
+
+	return body, err
+}
+
+func (s *avitoService) doOnce(ctx context.Context, client *http.Client, userId int, method, url string, payload []byte) ([]byte, error) {
+	token, err := s.tokens.Token(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var reqBody io.Reader = stdhttp.NoBody
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := stdhttp.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	return client.Do(ctx, req)
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mngn84/avito-cons/internal/models/avito_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+const (
+	// OpenAI Assistants threads and runs
+	BackendAssistants = "assistants"
+	// Chat Completions with the history from the messages table
+	BackendChat = "chat"
+)
+
+type backendRouter struct {
+	backends map[string]OpenAIService
+}
+
+// NewBackendRouter dispatches every request to the backend selected in the
+// profile. Knowledge files only exist for the assistants backend.
+func NewBackendRouter(backends map[string]OpenAIService) OpenAIService {
+	return &backendRouter{backends: backends}
+}
+
+func (r *backendRouter) GetResponse(ctx context.Context, profile *storage.Profile, text string, images [][]byte, chatId string, msgId string, itemInfo avito_models.Value) (Response, error) {
+	backend, ok := r.backends[profile.Backend]
+	if !ok {
+		return Response{}, fmt.Errorf("unknown backend %q for user %d", profile.Backend, profile.UserId)
+	}
+	// threads and runs only exist at OpenAI
+	if profile.Backend == BackendAssistants && profile.Provider != ProviderOpenAI {
+		return Response{}, fmt.Errorf("provider %q needs the %s backend, user %d", profile.Provider, BackendChat, profile.UserId)
+	}
+
+	return backend.GetResponse(ctx, profile, text, images, chatId, msgId, itemInfo)
+}
+
+func (r *backendRouter) UploadFileToVectorStore(ctx context.Context, file io.Reader, fileName, profileName, fileType string) (string, error) {
+	return r.backends[BackendAssistants].UploadFileToVectorStore(ctx, file, fileName, profileName, fileType)
+}
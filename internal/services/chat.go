@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/models/avito_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+// a model that keeps calling tools is cut off after this many rounds
+const maxToolRounds = 5
+
+type chatService struct {
+	config    *config.Config
+	logger    *slog.Logger
+	db        storage.MessageRepo
+	providers map[string]Provider
+	tools     *ToolRegistry
+}
+
+// NewChatService answers with a chat model, building the context from the
+// messages table instead of an Assistants thread. The model is served by the
+// provider selected in the profile.
+func NewChatService(config *config.Config, logger *slog.Logger, db storage.MessageRepo, providers map[string]Provider, tools *ToolRegistry) OpenAIService {
+	return &chatService{
+		config:    config,
+		logger:    logger,
+		db:        db,
+		providers: providers,
+		tools:     tools,
+	}
+}
+
+func (s *chatService) GetResponse(ctx context.Context, profile *storage.Profile, text string, images [][]byte, chatId string, msgId string, itemInfo avito_models.Value) (Response, error) {
+	provider, ok := s.providers[profile.Provider]
+	if !ok {
+		return Response{}, fmt.Errorf("unknown provider %q for user %d", profile.Provider, profile.UserId)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.OpenAI.Timeout)
+	defer cancel()
+
+	// the current message is already stored, it is added below with images
+	history, err := s.db.GetMessages(ctx, s.config.DB.HistoryLimit, chatId, msgId)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to get history: %w", err)
+	}
+
+	messages := []ChatMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: s.systemPrompt(profile, itemInfo),
+	}}
+	// history is newest first
+	for i := len(history) - 1; i >= 0; i-- {
+		messages = append(messages, ChatMessage{
+			Role:    history[i].Role,
+			Content: history[i].Content,
+		})
+	}
+	messages = append(messages, ChatMessage{Role: openai.ChatMessageRoleUser, Content: text, Images: images})
+
+	toolCtx := &ToolContext{
+		Profile:  profile,
+		ChatId:   chatId,
+		Item:     itemInfo,
+		Response: &Response{},
+	}
+
+	answer, err := s.complete(ctx, provider, profile, messages, toolCtx)
+	if err != nil {
+		return Response{}, err
+	}
+	toolCtx.Response.Text = answer
+
+	return *toolCtx.Response, nil
+}
+
+// complete runs the completion, executing requested tools, until the model
+// answers with text.
+func (s *chatService) complete(ctx context.Context, provider Provider, profile *storage.Profile, messages []ChatMessage, toolCtx *ToolContext) (string, error) {
+	for round := 0; ; round++ {
+		request := CompletionRequest{
+			Model:       profile.Model,
+			Messages:    messages,
+			Temperature: s.config.OpenAI.Temperature,
+			BaseUrl:     profile.CompatibleUrl,
+		}
+		if round < maxToolRounds {
+			request.Tools = s.tools.ToolDefinitions()
+		}
+
+		res, err := provider.Complete(ctx, request)
+		if err != nil {
+			return "", err
+		}
+		toolCtx.Response.Usage.PromptTokens += res.Usage.PromptTokens
+		toolCtx.Response.Usage.CompletionTokens += res.Usage.CompletionTokens
+		toolCtx.Response.Usage.TotalTokens += res.Usage.TotalTokens
+
+		msg := res.Message
+		if len(msg.ToolCalls) != 0 && round >= maxToolRounds {
+			// the tools were withheld and the model still calls them
+			return "", fmt.Errorf("model kept calling tools after %d rounds", maxToolRounds)
+		}
+		if len(msg.ToolCalls) == 0 {
+			if msg.Content == "" && toolCtx.Response.Escalation == nil {
+				return "", fmt.Errorf("empty chat completion")
+			}
+			return msg.Content, nil
+		}
+
+		messages = append(messages, msg)
+		for _, call := range msg.ToolCalls {
+			s.logger.Info("calling tool", "tool", call.Name, "chat_id", toolCtx.ChatId)
+			messages = append(messages, ChatMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    s.tools.Call(ctx, toolCtx, call.Name, call.Arguments),
+				ToolCallId: call.Id,
+			})
+		}
+	}
+}
+
+func (s *chatService) systemPrompt(profile *storage.Profile, itemInfo avito_models.Value) string {
+	if itemInfo.Title == "" {
+		return profile.SystemPrompt
+	}
+	return fmt.Sprintf("%s\n\nКлиент пишет по объявлению %s %s %s", profile.SystemPrompt, itemInfo.Title, itemInfo.PriceString, itemInfo.Url)
+}
+
+func (s *chatService) UploadFileToVectorStore(ctx context.Context, file io.Reader, fileName, profileName, fileType string) (string, error) {
+	return "", fmt.Errorf("knowledge files are not supported by the %s backend", BackendChat)
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/models/avito_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+	"github.com/mngn84/avito-cons/internal/storage/memory"
+)
+
+// recordingProvider keeps the requests and answers with the next scripted
+// result, or through next once the script is over.
+type recordingProvider struct {
+	next   Provider
+	script []CompletionResult
+
+	mu       sync.Mutex
+	requests []CompletionRequest
+}
+
+func (p *recordingProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, req)
+	if len(p.script) > 0 {
+		res := p.script[0]
+		p.script = p.script[1:]
+		return res, nil
+	}
+	return p.next.Complete(ctx, req)
+}
+
+func newTestChat(db *memory.Store, provider Provider) OpenAIService {
+	cfg := &config.Config{
+		OpenAI: config.OpenAIConfig{Timeout: time.Minute},
+		DB:     config.PgConfig{HistoryLimit: 10},
+	}
+	tools := NewToolRegistry(testLogger())
+	RegisterEscalationTool(tools)
+
+	return NewChatService(cfg, testLogger(), db, map[string]Provider{ProviderFake: provider}, tools)
+}
+
+func saveTestMessage(t *testing.T, db *memory.Store, m storage.Message) {
+	t.Helper()
+	if _, err := db.SaveMessage(context.Background(), m); err != nil {
+		t.Fatalf("SaveMessage: %v", err)
+	}
+}
+
+func TestChatHistoryOrder(t *testing.T) {
+	db := memory.NewStore()
+	provider := &recordingProvider{next: NewFakeProvider(&config.Config{})}
+	chat := newTestChat(db, provider)
+
+	saveTestMessage(t, db, storage.Message{ChatId: "c1", AvitoMsgId: "m1", Content: "hi", Role: "user", CreatedAt: 100})
+	// stored after the next customer message, it is still older context
+	saveTestMessage(t, db, storage.Message{ChatId: "c1", AvitoMsgId: "m2", Content: "is it new?", Role: "user", CreatedAt: 300})
+	saveTestMessage(t, db, storage.Message{ChatId: "c1", AvitoMsgId: "r1", Content: "hello", Role: "assistant", CreatedAt: 200, SentAt: 200})
+	saveTestMessage(t, db, storage.Message{ChatId: "c1", AvitoMsgId: "m3", Content: "price?", Role: "user", CreatedAt: 400})
+	saveTestMessage(t, db, storage.Message{ChatId: "c2", AvitoMsgId: "x1", Content: "other chat", Role: "user", CreatedAt: 150})
+
+	profile := &storage.Profile{UserId: 1, SystemPrompt: "be nice", Provider: ProviderFake}
+	res, err := chat.GetResponse(context.Background(), profile, "price?", nil, "c1", "m3", avito_models.Value{Title: "Bike"})
+	if err != nil {
+		t.Fatalf("GetResponse: %v", err)
+	}
+	if res.Text != "echo: price?" {
+		t.Fatalf("Text = %q, want the fake echo", res.Text)
+	}
+
+	if len(provider.requests) != 1 {
+		t.Fatalf("%d completions, want 1", len(provider.requests))
+	}
+	messages := provider.requests[0].Messages
+
+	if messages[0].Role != openai.ChatMessageRoleSystem || !strings.Contains(messages[0].Content, "Bike") {
+		t.Fatalf("system message = %+v, want the prompt with the item", messages[0])
+	}
+
+	want := []ChatMessage{
+		{Role: "user", Content: "hi"},
+		{Role: "user", Content: "is it new?"},
+		{Role: "assistant", Content: "hello"},
+		{Role: "user", Content: "price?"},
+	}
+	got := messages[1:]
+	if len(got) != len(want) {
+		t.Fatalf("messages = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Role != want[i].Role || got[i].Content != want[i].Content {
+			t.Fatalf("message %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestChatToolRounds(t *testing.T) {
+	db := memory.NewStore()
+	provider := &recordingProvider{
+		next: NewFakeProvider(&config.Config{LLM: config.LLMConfig{FakeReply: "a manager will answer"}}),
+		script: []CompletionResult{{
+			Message: ChatMessage{
+				Role: openai.ChatMessageRoleAssistant,
+				ToolCalls: []ToolCall{{
+					Id:        "call_1",
+					Name:      escalateToolName,
+					Arguments: `{"reason": "call_request", "summary": "wants a call"}`,
+				}},
+			},
+			Usage: Usage{TotalTokens: 10},
+		}},
+	}
+	chat := newTestChat(db, provider)
+	saveTestMessage(t, db, storage.Message{ChatId: "c1", AvitoMsgId: "m1", Content: "call me", Role: "user", CreatedAt: 100})
+
+	profile := &storage.Profile{UserId: 1, Provider: ProviderFake}
+	res, err := chat.GetResponse(context.Background(), profile, "call me", nil, "c1", "m1", avito_models.Value{})
+	if err != nil {
+		t.Fatalf("GetResponse: %v", err)
+	}
+
+	if res.Text != "a manager will answer" {
+		t.Fatalf("Text = %q, want the answer after the tool round", res.Text)
+	}
+	if res.Escalation == nil || res.Escalation.Reason != "call_request" {
+		t.Fatalf("Escalation = %+v, want the tool arguments", res.Escalation)
+	}
+	if res.Usage.TotalTokens != 10 {
+		t.Fatalf("TotalTokens = %d, want the usage of both rounds", res.Usage.TotalTokens)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("%d completions, want 2", len(provider.requests))
+	}
+	// the second round sees the call and its output
+	messages := provider.requests[1].Messages
+	call, output := messages[len(messages)-2], messages[len(messages)-1]
+	if len(call.ToolCalls) != 1 || call.ToolCalls[0].Id != "call_1" {
+		t.Fatalf("tool call message = %+v", call)
+	}
+	if output.Role != openai.ChatMessageRoleTool || output.ToolCallId != "call_1" || !strings.Contains(output.Content, "escalation_requested") {
+		t.Fatalf("tool output message = %+v", output)
+	}
+}
+
+func TestChatToolRoundsAreLimited(t *testing.T) {
+	db := memory.NewStore()
+	looping := ChatMessage{
+		Role:      openai.ChatMessageRoleAssistant,
+		ToolCalls: []ToolCall{{Id: "call", Name: "unknown_tool", Arguments: `{}`}},
+	}
+	provider := &recordingProvider{next: NewFakeProvider(&config.Config{})}
+	for i := 0; i < maxToolRounds; i++ {
+		provider.script = append(provider.script, CompletionResult{Message: looping})
+	}
+	chat := newTestChat(db, provider)
+
+	profile := &storage.Profile{UserId: 1, Provider: ProviderFake}
+	res, err := chat.GetResponse(context.Background(), profile, "hi", nil, "c1", "m1", avito_models.Value{})
+	if err != nil {
+		t.Fatalf("GetResponse: %v", err)
+	}
+	if res.Text != "echo: hi" {
+		t.Fatalf("Text = %q, want the answer of the last round", res.Text)
+	}
+
+	if len(provider.requests) != maxToolRounds+1 {
+		t.Fatalf("%d completions, want %d", len(provider.requests), maxToolRounds+1)
+	}
+	if tools := provider.requests[maxToolRounds].Tools; len(tools) != 0 {
+		t.Fatalf("the last round offered %d tools, want none", len(tools))
+	}
+}
+
+func TestChatFailsWhenToolCallsPersist(t *testing.T) {
+	db := memory.NewStore()
+	looping := ChatMessage{
+		Role:      openai.ChatMessageRoleAssistant,
+		ToolCalls: []ToolCall{{Id: "call", Name: "unknown_tool", Arguments: `{}`}},
+	}
+	provider := &recordingProvider{next: NewFakeProvider(&config.Config{})}
+	// the last round calls tools although none were offered
+	for i := 0; i <= maxToolRounds; i++ {
+		provider.script = append(provider.script, CompletionResult{Message: looping})
+	}
+	chat := newTestChat(db, provider)
+
+	profile := &storage.Profile{UserId: 1, Provider: ProviderFake}
+	if _, err := chat.GetResponse(context.Background(), profile, "hi", nil, "c1", "m1", avito_models.Value{}); err == nil {
+		t.Fatal("GetResponse succeeded with tool calls in the last round")
+	}
+	if len(provider.requests) != maxToolRounds+1 {
+		t.Fatalf("%d completions, want %d", len(provider.requests), maxToolRounds+1)
+	}
+}
+
+func TestChatHistorySkipsUnsentReplies(t *testing.T) {
+	db := memory.NewStore()
+	provider := &recordingProvider{next: NewFakeProvider(&config.Config{})}
+	chat := newTestChat(db, provider)
+
+	saveTestMessage(t, db, storage.Message{ChatId: "c1", AvitoMsgId: "m1", Content: "hi", Role: "user", CreatedAt: 100})
+	// a draft: recorded, but never seen by the customer
+	saveTestMessage(t, db, storage.Message{ChatId: "c1", Content: "draft", Role: "assistant", CreatedAt: 200, RunId: "run_1"})
+	saveTestMessage(t, db, storage.Message{ChatId: "c1", AvitoMsgId: "m2", Content: "hello?", Role: "user", CreatedAt: 300})
+
+	profile := &storage.Profile{UserId: 1, Provider: ProviderFake}
+	if _, err := chat.GetResponse(context.Background(), profile, "hello?", nil, "c1", "m2", avito_models.Value{}); err != nil {
+		t.Fatalf("GetResponse: %v", err)
+	}
+
+	for _, msg := range provider.requests[0].Messages {
+		if msg.Content == "draft" {
+			t.Fatalf("an unsent reply was passed as context: %+v", provider.requests[0].Messages)
+		}
+	}
+}
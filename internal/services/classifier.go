@@ -0,0 +1,60 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+)
+
+type MsgClass string
+
+const (
+	// written by the customer and understood by the assistant
+	MsgFromCustomer MsgClass = "customer"
+	// written from the account itself: by us or by a manager in the Avito UI
+	MsgFromAccount MsgClass = "own"
+	// Avito service notifications
+	MsgSystem  MsgClass = "system"
+	MsgDeleted MsgClass = "deleted"
+	// written by the customer, but the assistant cannot use the content
+	MsgUnsupported MsgClass = "unsupported"
+)
+
+// ClassifyMessage decides whether an incoming message is customer content
+// that should reach the assistant. Anything else must not trigger a run:
+// answering our own messages leads to reply loops.
+func ClassifyMessage(msg *handlers_models.FromAvitoMsg) MsgClass {
+	switch handlers_models.MsgType(msg.Type) {
+	case handlers_models.SystemMsg:
+		return MsgSystem
+	case handlers_models.DeletedMsg:
+		return MsgDeleted
+	}
+
+	if msg.AuthorId == 0 {
+		return MsgSystem
+	}
+	if msg.AuthorId == msg.UserId {
+		return MsgFromAccount
+	}
+
+	switch handlers_models.MsgType(msg.Type) {
+	case handlers_models.TextMsg:
+		if strings.TrimSpace(msg.Content.Text) == "" {
+			return MsgUnsupported
+		}
+		return MsgFromCustomer
+	case handlers_models.ImageMsg:
+		if msg.Content.Image == nil || msg.Content.Image.LargestUrl() == "" {
+			return MsgUnsupported
+		}
+		return MsgFromCustomer
+	case handlers_models.VoiceMsg:
+		if msg.Content.Voice == nil || msg.Content.Voice.VoiceId == "" {
+			return MsgUnsupported
+		}
+		return MsgFromCustomer
+	}
+
+	return MsgUnsupported
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+)
+
+func TestDecodeWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantId  string
+		wantErr error
+		anyErr  bool
+	}{
+		{
+			name:   "v3 envelope",
+			data:   `{"id": "e1", "version": "v3", "timestamp": 1700000000, "payload": {"type": "message", "value": {"id": "m1", "user_id": 1, "author_id": 2, "chat_id": "c1", "type": "text", "content": {"text": "hi"}}}}`,
+			wantId: "m1",
+		},
+		{
+			name:   "v3 minor version",
+			data:   `{"id": "e1", "version": "v3.1.0", "payload": {"type": "message", "value": {"id": "m2", "user_id": 1, "author_id": 2, "chat_id": "c1", "type": "text"}}}`,
+			wantId: "m2",
+		},
+		{
+			name:   "flat legacy message",
+			data:   `{"id": "m3", "user_id": 1, "author_id": 2, "chat_id": "c1", "type": "text", "content": {"text": "hi"}}`,
+			wantId: "m3",
+		},
+		{
+			name:    "unsupported version",
+			data:    `{"id": "e1", "version": "v2", "payload": {"type": "message", "value": {"id": "m1"}}}`,
+			wantErr: handlers_models.ErrUnsupportedVersion,
+		},
+		{
+			name:    "v30 is not v3",
+			data:    `{"id": "e1", "version": "v30", "payload": {"type": "message", "value": {"id": "m1"}}}`,
+			wantErr: handlers_models.ErrUnsupportedVersion,
+		},
+		{
+			name:    "not a message",
+			data:    `{"id": "e1", "version": "v3", "payload": {"type": "chat_blocked", "value": {}}}`,
+			wantErr: handlers_models.ErrUnsupportedPayload,
+		},
+		{
+			name:   "malformed message value",
+			data:   `{"id": "e1", "version": "v3", "payload": {"type": "message", "value": {"id": 5}}}`,
+			anyErr: true,
+		},
+		{
+			name:   "malformed json",
+			data:   `{"id":`,
+			anyErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := handlers_models.DecodeWebhook([]byte(tt.data))
+			if tt.wantErr != nil || tt.anyErr {
+				if err == nil {
+					t.Fatalf("DecodeWebhook = %+v, want an error", msg)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeWebhook: %v", err)
+			}
+			if msg.Id != tt.wantId || msg.UserId != 1 || msg.AuthorId != 2 || msg.ChatId != "c1" {
+				t.Fatalf("msg = %+v, want %s from author 2 in c1 of account 1", msg, tt.wantId)
+			}
+		})
+	}
+}
+
+func TestLargestUrl(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizes map[string]string
+		want  string
+	}{
+		{"none", nil, ""},
+		{"by pixels, not by key", map[string]string{"640x480": "small", "1280x960": "large", "140x105": "thumb"}, "large"},
+		{"empty urls are skipped", map[string]string{"1280x960": "", "640x480": "small"}, "small"},
+		{"a resolution beats other keys", map[string]string{"original": "orig", "32x32": "tiny"}, "tiny"},
+		{"other keys as a last resort", map[string]string{"original": "orig"}, "orig"},
+		{"ties are stable", map[string]string{"10x20": "b", "20x10": "a"}, "a"},
+	}
+
+	for _, tt := range tests {
+		content := handlers_models.ImageContent{Sizes: tt.sizes}
+		if got := content.LargestUrl(); got != tt.want {
+			t.Errorf("%s: LargestUrl = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyMessage(t *testing.T) {
+	image := &handlers_models.ImageContent{Sizes: map[string]string{"640x480": "https://img"}}
+
+	tests := []struct {
+		name string
+		msg  handlers_models.FromAvitoMsg
+		want MsgClass
+	}{
+		{"text", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 2, Type: "text", Content: handlers_models.MsgContent{Text: "hi"}}, MsgFromCustomer},
+		{"blank text", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 2, Type: "text", Content: handlers_models.MsgContent{Text: "  "}}, MsgUnsupported},
+		{"image", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 2, Type: "image", Content: handlers_models.MsgContent{Image: image}}, MsgFromCustomer},
+		{"image without sizes", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 2, Type: "image", Content: handlers_models.MsgContent{Image: &handlers_models.ImageContent{}}}, MsgUnsupported},
+		{"voice", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 2, Type: "voice", Content: handlers_models.MsgContent{Voice: &handlers_models.VoiceContent{VoiceId: "v1"}}}, MsgFromCustomer},
+		{"voice without id", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 2, Type: "voice"}, MsgUnsupported},
+		{"own message", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 1, Type: "text", Content: handlers_models.MsgContent{Text: "hi"}}, MsgFromAccount},
+		{"no author", handlers_models.FromAvitoMsg{UserId: 1, Type: "text", Content: handlers_models.MsgContent{Text: "hi"}}, MsgSystem},
+		{"system", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 2, Type: "system", Content: handlers_models.MsgContent{Text: "item sold"}}, MsgSystem},
+		{"deleted", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 2, Type: "deleted"}, MsgDeleted},
+		{"own deleted", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 1, Type: "deleted"}, MsgDeleted},
+		{"item", handlers_models.FromAvitoMsg{UserId: 1, AuthorId: 2, Type: "item"}, MsgUnsupported},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifyMessage(&tt.msg); got != tt.want {
+			t.Errorf("%s: ClassifyMessage = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+
+	"github.com/mngn84/avito-cons/internal/http"
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+var failedDeliveryUpdates = expvar.NewInt("delivery_update_failed")
+
+type DeliveryService interface {
+	// Deliver returns the Avito id of the sent message, empty for drafts.
+	Deliver(ctx context.Context, profile *storage.Profile, msg *handlers_models.FromAvitoMsg, text string) (string, error)
+	// Replied reports whether a reply to msg may already be in the chat.
+	Replied(ctx context.Context, msg *handlers_models.FromAvitoMsg) (bool, error)
+}
+
+type deliveryService struct {
+	avito  AvitoService
+	db     storage.DeliveryRepo
+	logger *slog.Logger
+}
+
+func NewDeliveryService(logger *slog.Logger, avito AvitoService, db storage.DeliveryRepo) DeliveryService {
+	return &deliveryService{
+		avito:  avito,
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (s *deliveryService) Deliver(ctx context.Context, profile *storage.Profile, msg *handlers_models.FromAvitoMsg, text string) (string, error) {
+	mode := profile.SendMode
+
+	delivery := storage.Delivery{
+		ChatId:      msg.ChatId,
+		UserId:      msg.UserId,
+		SourceMsgId: msg.Id,
+		Content:     text,
+		Mode:        mode,
+		Status:      storage.DeliveryPending,
+	}
+
+	if mode == storage.SendModeDraft {
+		s.logger.Info("saving reply as draft", "chat_id", msg.ChatId)
+		delivery.Status = storage.DeliveryDraft
+		if _, err := s.db.SaveDelivery(ctx, delivery); err != nil {
+			return "", fmt.Errorf("failed to save draft: %w", err)
+		}
+		return "", nil
+	}
+
+	// recorded before sending: the webhook of the sent message may come
+	// before SendMessage returns and must not be taken for a manager reply
+	id, err := s.db.SaveDelivery(ctx, delivery)
+	if err != nil {
+		return "", fmt.Errorf("failed to save delivery: %w", err)
+	}
+
+	res, err := s.avito.SendMessage(ctx, msg.UserId, msg.ChatId, text)
+
+	// the reply may be in the chat already, so failures below must not make
+	// the job retry and send it twice, nor be lost with a cancelled job
+	dbCtx := context.WithoutCancel(ctx)
+
+	if err != nil {
+		// a timed out send may still reach the chat, its delivery stays
+		// pending; Avito refusing it is final
+		statusErr := &http.StatusError{}
+		if errors.As(err, &statusErr) {
+			s.update(dbCtx, id, storage.DeliveryFailed, "", msg.ChatId)
+		}
+		return "", fmt.Errorf("failed to send message: %w", err)
+	}
+	s.logger.Info("reply sent", "chat_id", msg.ChatId, "avito_msg_id", res.Id)
+	s.update(dbCtx, id, storage.DeliverySent, res.Id, msg.ChatId)
+
+	if err := s.avito.ReadChat(dbCtx, msg.UserId, msg.ChatId); err != nil {
+		s.logger.Error("failed to mark chat as read", "error", err, "chat_id", msg.ChatId)
+	}
+
+	return res.Id, nil
+}
+
+// Replied reports whether an earlier attempt at msg got as far as sending. A
+// send that timed out may have reached the chat, so its pending delivery
+// counts too: a retried job must not post a second answer.
+func (s *deliveryService) Replied(ctx context.Context, msg *handlers_models.FromAvitoMsg) (bool, error) {
+	if msg.Id == "" {
+		return false, nil
+	}
+
+	replied, err := s.db.HasReply(ctx, msg.Id)
+	if err != nil {
+		return false, fmt.Errorf("failed to check deliveries: %w", err)
+	}
+	return replied, nil
+}
+
+// update records the outcome of the send. A failure only loses the audit and
+// the match by id, the pending delivery is still matched by text for an
+// hour, so it is logged and counted instead of failing the job.
+func (s *deliveryService) update(ctx context.Context, id int64, status, avitoMsgId, chatId string) {
+	if err := s.db.UpdateDelivery(ctx, id, status, avitoMsgId); err != nil {
+		failedDeliveryUpdates.Add(1)
+		s.logger.Error("failed to update delivery", "error", err, "delivery_id", id, "status", status, "chat_id", chatId)
+	}
+}
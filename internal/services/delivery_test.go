@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mngn84/avito-cons/internal/http"
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+	"github.com/mngn84/avito-cons/internal/storage/memory"
+)
+
+func TestDeliverSends(t *testing.T) {
+	db := memory.NewStore()
+	avito := &fakeAvito{}
+	delivery := NewDeliveryService(testLogger(), avito, db)
+	ctx := context.Background()
+
+	msg := &handlers_models.FromAvitoMsg{Id: "m1", ChatId: "c1", UserId: 1}
+	id, err := delivery.Deliver(ctx, &storage.Profile{UserId: 1, SendMode: storage.SendModeAuto}, msg, "hello")
+	if err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if id != "sent-c1" || len(avito.sent) != 1 {
+		t.Fatalf("Deliver = %q with %d sends, want one send", id, len(avito.sent))
+	}
+
+	if ok, err := db.IsDelivered(ctx, "c1", id, ""); err != nil || !ok {
+		t.Fatalf("IsDelivered = %t, %v, want the sent id recorded", ok, err)
+	}
+}
+
+func TestDeliverDraft(t *testing.T) {
+	db := memory.NewStore()
+	avito := &fakeAvito{}
+	delivery := NewDeliveryService(testLogger(), avito, db)
+
+	msg := &handlers_models.FromAvitoMsg{Id: "m1", ChatId: "c1", UserId: 1}
+	id, err := delivery.Deliver(context.Background(), &storage.Profile{UserId: 1, SendMode: storage.SendModeDraft}, msg, "hello")
+	if err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if id != "" || len(avito.sent) != 0 {
+		t.Fatalf("draft was sent: %q, %v", id, avito.sent)
+	}
+}
+
+func TestDeliverRefused(t *testing.T) {
+	db := memory.NewStore()
+	avito := &fakeAvito{sendErr: &http.StatusError{StatusCode: 400}}
+	delivery := NewDeliveryService(testLogger(), avito, db)
+	ctx := context.Background()
+
+	msg := &handlers_models.FromAvitoMsg{Id: "m1", ChatId: "c1", UserId: 1}
+	_, err := delivery.Deliver(ctx, &storage.Profile{UserId: 1, SendMode: storage.SendModeAuto}, msg, "hello")
+	statusErr := &http.StatusError{}
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Deliver error = %v, want the status error", err)
+	}
+
+	// a refused reply is not in the chat, its text must not hide a manager
+	if ok, err := db.IsDelivered(ctx, "c1", "a1", "hello"); err != nil || ok {
+		t.Fatalf("IsDelivered = %t, %v, want false for a failed delivery", ok, err)
+	}
+}
+
+func TestDeliverTimeoutCountsAsReplied(t *testing.T) {
+	db := memory.NewStore()
+	avito := &fakeAvito{sendErr: context.DeadlineExceeded}
+	delivery := NewDeliveryService(testLogger(), avito, db)
+	ctx := context.Background()
+
+	msg := &handlers_models.FromAvitoMsg{Id: "m1", ChatId: "c1", UserId: 1}
+	if replied, err := delivery.Replied(ctx, msg); err != nil || replied {
+		t.Fatalf("Replied before sending = %t, %v, want false", replied, err)
+	}
+
+	if _, err := delivery.Deliver(ctx, &storage.Profile{UserId: 1, SendMode: storage.SendModeAuto}, msg, "hello"); err == nil {
+		t.Fatal("Deliver succeeded with a failing send")
+	}
+
+	// the send may have reached the chat, the retried job must not answer
+	if replied, err := delivery.Replied(ctx, msg); err != nil || !replied {
+		t.Fatalf("Replied after a timeout = %t, %v, want true", replied, err)
+	}
+}
+
+func TestDeliverRefusalAllowsRetry(t *testing.T) {
+	db := memory.NewStore()
+	avito := &fakeAvito{sendErr: &http.StatusError{StatusCode: 500}}
+	delivery := NewDeliveryService(testLogger(), avito, db)
+	ctx := context.Background()
+
+	msg := &handlers_models.FromAvitoMsg{Id: "m1", ChatId: "c1", UserId: 1}
+	delivery.Deliver(ctx, &storage.Profile{UserId: 1, SendMode: storage.SendModeAuto}, msg, "hello")
+
+	if replied, err := delivery.Replied(ctx, msg); err != nil || replied {
+		t.Fatalf("Replied after a refused send = %t, %v, want false", replied, err)
+	}
+}
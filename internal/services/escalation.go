@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+const escalateToolName = "escalate_to_human"
+
+// Escalation is requested by the assistant through the escalate_to_human tool.
+type Escalation struct {
+	Reason  string `json:"reason"`
+	Summary string `json:"summary"`
+}
+
+// RegisterEscalationTool adds the escalate_to_human tool. The chat is handed
+// off by the caller of the run, the tool only records the request.
+func RegisterEscalationTool(registry *ToolRegistry) {
+	registry.Register(openai.FunctionDefinition{
+		Name: escalateToolName,
+		Description: "Передать чат менеджеру. Вызывай, если клиент жалуется, просит позвонить или связаться с человеком, " +
+			"торгуется сильнее допустимого или задаёт вопрос, на который нельзя ответить по имеющимся данным. " +
+			"После вызова коротко сообщи клиенту, что его вопрос передан менеджеру.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"reason": {"type": "string", "enum": ["complaint", "call_request", "price", "other"]},
+				"summary": {"type": "string", "description": "Краткое содержание диалога для менеджера"}
+			},
+			"required": ["reason", "summary"]
+		}`),
+	}, func(ctx context.Context, toolCtx *ToolContext, args json.RawMessage) (any, error) {
+		escalation := Escalation{}
+		if err := json.Unmarshal(args, &escalation); err != nil {
+			// escalate anyway, the manager will read the chat
+			escalation.Reason = "other"
+		}
+		toolCtx.Response.Escalation = &escalation
+
+		// the hand-off and the notification happen after the run, the model
+		// must not promise that anyone was notified yet
+		return map[string]any{"ok": true, "status": "escalation_requested"}, nil
+	})
+}
+
+type EscalationService interface {
+	Escalate(ctx context.Context, profile *storage.Profile, msg *handlers_models.FromAvitoMsg, escalation *Escalation) error
+}
+
+type escalationService struct {
+	handoff  HandoffService
+	notifier Notifier
+	logger   *slog.Logger
+}
+
+func NewEscalationService(logger *slog.Logger, handoff HandoffService, notifier Notifier) EscalationService {
+	return &escalationService{
+		handoff:  handoff,
+		notifier: notifier,
+		logger:   logger,
+	}
+}
+
+// Escalate hands the chat off to a manager and notifies them. The chat state
+// is what stops the bot, so only its failure is returned.
+func (s *escalationService) Escalate(ctx context.Context, profile *storage.Profile, msg *handlers_models.FromAvitoMsg, escalation *Escalation) error {
+	if err := s.handoff.HandOff(ctx, msg.UserId, msg.ChatId, "escalation: "+escalation.Reason); err != nil {
+		return err
+	}
+	s.logger.Info("chat escalated to manager", "chat_id", msg.ChatId, "reason", escalation.Reason)
+
+	err := s.notifier.Notify(ctx, Notification{
+		UserId:      msg.UserId,
+		ProfileName: profile.ProfileName,
+		ChatId:      msg.ChatId,
+		ChatUrl:     fmt.Sprintf("https://www.avito.ru/profile/messenger/channel/%s", msg.ChatId),
+		Reason:      escalation.Reason,
+		Summary:     escalation.Summary,
+	})
+	if err != nil {
+		s.logger.Error("failed to notify about escalation", "error", err, "chat_id", msg.ChatId)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+type HandoffService interface {
+	State(ctx context.Context, userId int, chatId string) (storage.ChatState, error)
+	IsActive(ctx context.Context, userId int, chatId string) (bool, error)
+	ObserveOwnMessage(ctx context.Context, msg *handlers_models.FromAvitoMsg) error
+	Pause(ctx context.Context, userId int, chatId string, ttl time.Duration, reason string) error
+	HandOff(ctx context.Context, userId int, chatId string, reason string) error
+	Resume(ctx context.Context, userId int, chatId string) error
+}
+
+type handoffService struct {
+	db     storage.ChatStateRepo
+	config *config.Config
+	logger *slog.Logger
+}
+
+func NewHandoffService(config *config.Config, logger *slog.Logger, db storage.ChatStateRepo) HandoffService {
+	return &handoffService{
+		db:     db,
+		config: config,
+		logger: logger,
+	}
+}
+
+// State returns the effective bot state of the chat of the account: a pause
+// whose TTL has passed is reported as active.
+func (s *handoffService) State(ctx context.Context, userId int, chatId string) (storage.ChatState, error) {
+	state, err := s.db.GetChatState(ctx, userId, chatId)
+	if err != nil {
+		return storage.ChatState{}, fmt.Errorf("failed to get chat state: %w", err)
+	}
+
+	if state == nil {
+		return storage.ChatState{ChatId: chatId, UserId: userId, State: storage.ChatActive}, nil
+	}
+	if state.State == storage.ChatPaused && state.PausedUntil != nil && time.Now().After(*state.PausedUntil) {
+		state.State = storage.ChatActive
+		state.PausedUntil = nil
+		state.Reason = ""
+	}
+
+	return *state, nil
+}
+
+func (s *handoffService) IsActive(ctx context.Context, userId int, chatId string) (bool, error) {
+	state, err := s.State(ctx, userId, chatId)
+	if err != nil {
+		return false, err
+	}
+	return state.State == storage.ChatActive, nil
+}
+
+// ObserveOwnMessage pauses the bot when a message written from the account
+// is not one of our replies, i.e. a manager answered in the Avito UI. Replies
+// still being sent are recognised by their text. A manual hand-off is left as
+// is.
+func (s *handoffService) ObserveOwnMessage(ctx context.Context, msg *handlers_models.FromAvitoMsg) error {
+	delivered, err := s.db.IsDelivered(ctx, msg.ChatId, msg.Id, msg.Content.Text)
+	if err != nil {
+		return fmt.Errorf("failed to check delivery: %w", err)
+	}
+	if delivered {
+		return nil
+	}
+
+	state, err := s.State(ctx, msg.UserId, msg.ChatId)
+	if err != nil {
+		return err
+	}
+	if state.State == storage.ChatHandedOff {
+		return nil
+	}
+
+	s.logger.Info("manager replied, pausing bot", "chat_id", msg.ChatId, "ttl", s.config.Handoff.PauseTTL)
+	return s.Pause(ctx, msg.UserId, msg.ChatId, s.config.Handoff.PauseTTL, "manager_reply")
+}
+
+// Pause stops the bot in the chat for ttl; zero ttl pauses until Resume.
+func (s *handoffService) Pause(ctx context.Context, userId int, chatId string, ttl time.Duration, reason string) error {
+	state := storage.ChatState{
+		ChatId: chatId,
+		UserId: userId,
+		State:  storage.ChatPaused,
+		Reason: reason,
+	}
+	if ttl > 0 {
+		until := time.Now().Add(ttl)
+		state.PausedUntil = &until
+	}
+
+	return s.set(ctx, state)
+}
+
+// HandOff gives the chat to a manager until Resume is called.
+func (s *handoffService) HandOff(ctx context.Context, userId int, chatId string, reason string) error {
+	return s.set(ctx, storage.ChatState{
+		ChatId: chatId,
+		UserId: userId,
+		State:  storage.ChatHandedOff,
+		Reason: reason,
+	})
+}
+
+func (s *handoffService) Resume(ctx context.Context, userId int, chatId string) error {
+	return s.set(ctx, storage.ChatState{
+		ChatId: chatId,
+		UserId: userId,
+		State:  storage.ChatActive,
+	})
+}
+
+func (s *handoffService) set(ctx context.Context, state storage.ChatState) error {
+	if err := s.db.SetChatState(ctx, state); err != nil {
+		return fmt.Errorf("failed to set chat state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+	"github.com/mngn84/avito-cons/internal/storage/memory"
+)
+
+func newTestHandoff(db *memory.Store) HandoffService {
+	cfg := &config.Config{Handoff: config.HandoffConfig{PauseTTL: time.Hour}}
+	return NewHandoffService(cfg, testLogger(), db)
+}
+
+func ownMessage(id, chatId, text string) *handlers_models.FromAvitoMsg {
+	return &handlers_models.FromAvitoMsg{
+		Id:      id,
+		ChatId:  chatId,
+		UserId:  1,
+		Type:    string(handlers_models.TextMsg),
+		Content: handlers_models.MsgContent{Text: text},
+	}
+}
+
+func TestHandoffManagerReplyPauses(t *testing.T) {
+	db := memory.NewStore()
+	handoff := newTestHandoff(db)
+	ctx := context.Background()
+
+	if err := handoff.ObserveOwnMessage(ctx, ownMessage("a1", "c1", "I will call you")); err != nil {
+		t.Fatalf("ObserveOwnMessage: %v", err)
+	}
+
+	state, err := handoff.State(ctx, 1, "c1")
+	if err != nil {
+		t.Fatalf("State: %v", err)
+	}
+	if state.State != storage.ChatPaused || state.PausedUntil == nil {
+		t.Fatalf("state = %+v, want paused with a TTL", state)
+	}
+}
+
+func TestHandoffIgnoresOwnReplies(t *testing.T) {
+	db := memory.NewStore()
+	handoff := newTestHandoff(db)
+	ctx := context.Background()
+
+	id, err := db.SaveDelivery(ctx, storage.Delivery{ChatId: "c1", UserId: 1, Content: "hello", Status: storage.DeliveryPending})
+	if err != nil {
+		t.Fatalf("SaveDelivery: %v", err)
+	}
+
+	// the webhook of a reply still being sent
+	if err := handoff.ObserveOwnMessage(ctx, ownMessage("a1", "c1", "hello")); err != nil {
+		t.Fatalf("ObserveOwnMessage: %v", err)
+	}
+
+	if err := db.UpdateDelivery(ctx, id, storage.DeliverySent, "a2"); err != nil {
+		t.Fatalf("UpdateDelivery: %v", err)
+	}
+	// a sent reply is matched by its id
+	if err := handoff.ObserveOwnMessage(ctx, ownMessage("a2", "c1", "")); err != nil {
+		t.Fatalf("ObserveOwnMessage: %v", err)
+	}
+
+	if active, err := handoff.IsActive(ctx, 1, "c1"); err != nil || !active {
+		t.Fatalf("IsActive = %t, %v, want true", active, err)
+	}
+}
+
+func TestHandoffKeepsManualHandOff(t *testing.T) {
+	db := memory.NewStore()
+	handoff := newTestHandoff(db)
+	ctx := context.Background()
+
+	if err := handoff.HandOff(ctx, 1, "c1", "escalation"); err != nil {
+		t.Fatalf("HandOff: %v", err)
+	}
+	if err := handoff.ObserveOwnMessage(ctx, ownMessage("a1", "c1", "hi, manager here")); err != nil {
+		t.Fatalf("ObserveOwnMessage: %v", err)
+	}
+
+	state, err := handoff.State(ctx, 1, "c1")
+	if err != nil {
+		t.Fatalf("State: %v", err)
+	}
+	if state.State != storage.ChatHandedOff {
+		t.Fatalf("state = %q, want %q", state.State, storage.ChatHandedOff)
+	}
+
+	if err := handoff.Resume(ctx, 1, "c1"); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if active, err := handoff.IsActive(ctx, 1, "c1"); err != nil || !active {
+		t.Fatalf("IsActive after Resume = %t, %v, want true", active, err)
+	}
+}
+
+func TestHandoffPauseExpires(t *testing.T) {
+	db := memory.NewStore()
+	handoff := newTestHandoff(db)
+	ctx := context.Background()
+
+	if err := handoff.Pause(ctx, 1, "c1", time.Nanosecond, "manager_reply"); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	if active, err := handoff.IsActive(ctx, 1, "c1"); err != nil || !active {
+		t.Fatalf("IsActive after the TTL = %t, %v, want true", active, err)
+	}
+}
+
+func TestHandoffStateIsPerAccount(t *testing.T) {
+	db := memory.NewStore()
+	handoff := newTestHandoff(db)
+	ctx := context.Background()
+
+	if err := handoff.HandOff(ctx, 2, "c1", "escalation"); err != nil {
+		t.Fatalf("HandOff: %v", err)
+	}
+
+	if active, err := handoff.IsActive(ctx, 1, "c1"); err != nil || !active {
+		t.Fatalf("IsActive of another account = %t, %v, want true", active, err)
+	}
+	if active, err := handoff.IsActive(ctx, 2, "c1"); err != nil || active {
+		t.Fatalf("IsActive = %t, %v, want false", active, err)
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/mngn84/avito-cons/internal/models/avito_models"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// fakeAvito records sent messages; methods a test does not need panic
+// through the nil AvitoService.
+type fakeAvito struct {
+	AvitoService
+
+	mu        sync.Mutex
+	sent      []string
+	sendErr   error
+	downloads int
+}
+
+func (f *fakeAvito) SendMessage(ctx context.Context, userId int, chatId string, text string) (avito_models.SendMsgResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.sendErr != nil {
+		return avito_models.SendMsgResponse{}, f.sendErr
+	}
+	f.sent = append(f.sent, text)
+	return avito_models.SendMsgResponse{Id: "sent-" + chatId}, nil
+}
+
+func (f *fakeAvito) ReadChat(ctx context.Context, userId int, chatId string) error {
+	return nil
+}
+
+func (f *fakeAvito) DownloadVoice(ctx context.Context, userId int, voiceId string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.downloads++
+	return []byte("audio " + voiceId), nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+type HistoryService interface {
+	SaveInbound(ctx context.Context, msg *handlers_models.FromAvitoMsg, text string) error
+	SaveReply(ctx context.Context, msg *handlers_models.FromAvitoMsg, res Response, avitoMsgId string) error
+}
+
+type historyService struct {
+	db     storage.MessageRepo
+	logger *slog.Logger
+}
+
+// NewHistoryService keeps the conversation in the messages table: the audit
+// trail and the context of the chat backend.
+func NewHistoryService(logger *slog.Logger, db storage.MessageRepo) HistoryService {
+	return &historyService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// SaveInbound stores the customer message once, retries of the job keep the
+// first copy. text is what the assistant sees, e.g. the voice transcript.
+func (s *historyService) SaveInbound(ctx context.Context, msg *handlers_models.FromAvitoMsg, text string) error {
+	if text == "" && handlers_models.MsgType(msg.Type) == handlers_models.ImageMsg {
+		text = "[фото]"
+	}
+
+	_, err := s.db.SaveMessage(ctx, storage.Message{
+		ChatId:     msg.ChatId,
+		UserId:     msg.UserId,
+		AvitoMsgId: msg.Id,
+		Content:    text,
+		Role:       "user",
+		CreatedAt:  msg.Created,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+
+	return nil
+}
+
+// SaveReply stores a generated reply with its run and usage. avitoMsgId is
+// empty when the reply was not sent: dropped, saved as a draft or failed.
+// Such replies stay out of the chat context.
+func (s *historyService) SaveReply(ctx context.Context, msg *handlers_models.FromAvitoMsg, res Response, avitoMsgId string) error {
+	now := int(time.Now().Unix())
+	sentAt := 0
+	if avitoMsgId != "" {
+		sentAt = now
+	}
+
+	_, err := s.db.SaveMessage(ctx, storage.Message{
+		ChatId:           msg.ChatId,
+		UserId:           msg.UserId,
+		AvitoMsgId:       avitoMsgId,
+		Content:          res.Text,
+		Role:             "assistant",
+		CreatedAt:        now,
+		ThreadId:         res.ThreadId,
+		RunId:            res.RunId,
+		PromptTokens:     res.Usage.PromptTokens,
+		CompletionTokens: res.Usage.CompletionTokens,
+		TotalTokens:      res.Usage.TotalTokens,
+		SentAt:           sentAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save reply: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// the tools take no arguments: they always read the item of the chat, so the
+// customer cannot make the model look up somebody else's item
+var noArgsSchema = json.RawMessage(`{"type": "object", "properties": {}}`)
+
+type itemTools struct {
+	avito AvitoService
+}
+
+// RegisterItemTools adds tools that read the Avito item of the chat.
+func RegisterItemTools(registry *ToolRegistry, avito AvitoService) {
+	t := &itemTools{avito: avito}
+
+	registry.Register(openai.FunctionDefinition{
+		Name:        "get_item_details",
+		Description: "Название, цена, ссылка, статус и сроки размещения объявления текущего чата.",
+		Parameters:  noArgsSchema,
+	}, t.details)
+
+	registry.Register(openai.FunctionDefinition{
+		Name:        "check_availability",
+		Description: "Проверить, что объявление текущего чата активно и товар ещё можно купить.",
+		Parameters:  noArgsSchema,
+	}, t.availability)
+}
+
+func (t *itemTools) itemId(toolCtx *ToolContext) (int, error) {
+	if toolCtx.Item.Id == 0 {
+		return 0, errors.New("the chat has no item")
+	}
+	return toolCtx.Item.Id, nil
+}
+
+func (t *itemTools) details(ctx context.Context, toolCtx *ToolContext, _ json.RawMessage) (any, error) {
+	itemId, err := t.itemId(toolCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := t.avito.GetItem(ctx, toolCtx.Profile.UserId, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"item_id":     itemId,
+		"title":       toolCtx.Item.Title,
+		"price":       toolCtx.Item.PriceString,
+		"status":      item.Status,
+		"url":         item.Url,
+		"start_time":  item.StartTime,
+		"finish_time": item.FinishTime,
+	}, nil
+}
+
+func (t *itemTools) availability(ctx context.Context, toolCtx *ToolContext, _ json.RawMessage) (any, error) {
+	itemId, err := t.itemId(toolCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := t.avito.GetItem(ctx, toolCtx.Profile.UserId, itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"item_id":   itemId,
+		"available": item.Status == "active",
+		"status":    item.Status,
+	}, nil
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	stdhttp "net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/http"
+)
+
+type Notification struct {
+	UserId      int    `json:"user_id"`
+	ProfileName string `json:"profile_name"`
+	ChatId      string `json:"chat_id"`
+	ChatUrl     string `json:"chat_url"`
+	Reason      string `json:"reason"`
+	Summary     string `json:"summary"`
+}
+
+func (n Notification) text() string {
+	return fmt.Sprintf("Нужен менеджер: %s\nАккаунт: %s (%d)\nПричина: %s\n\n%s",
+		n.ChatUrl, n.ProfileName, n.UserId, n.Reason, n.Summary)
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// a notification channel that hangs must not hold a queue worker past its
+// lease
+const notifyTimeout = 10 * time.Second
+
+// NewNotifier sends notifications to every configured channel. Without any
+// channel the notifications are only logged.
+func NewNotifier(config *config.Config, logger *slog.Logger) Notifier {
+	client := http.NewClient(&stdhttp.Client{Timeout: notifyTimeout}, nil, http.RetryConfig{
+		MaxRetries: 3,
+		BaseDelay:  1 * time.Second,
+		MaxDelay:   5 * time.Second,
+	})
+
+	notifiers := multiNotifier{}
+	cfg := config.Notify
+	if cfg.WebhookUrl != "" {
+		notifiers = append(notifiers, NewWebhookNotifier(client, cfg.WebhookUrl))
+	}
+	if cfg.TelegramToken != "" {
+		notifiers = append(notifiers, NewTelegramNotifier(client, cfg.TelegramApiUrl, cfg.TelegramToken, cfg.TelegramChatId))
+	}
+	if cfg.SMTPAddr != "" {
+		notifiers = append(notifiers, NewSMTPNotifier(cfg.SMTPAddr, cfg.SMTPUser, cfg.SMTPPassword, cfg.SMTPFrom, cfg.SMTPTo))
+	}
+	if len(notifiers) == 0 {
+		return &logNotifier{logger: logger}
+	}
+
+	return notifiers
+}
+
+type multiNotifier []Notifier
+
+func (m multiNotifier) Notify(ctx context.Context, n Notification) error {
+	errs := []error{}
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type logNotifier struct {
+	logger *slog.Logger
+}
+
+func (l *logNotifier) Notify(ctx context.Context, n Notification) error {
+	l.logger.Warn("escalation without notification channel", "chat_id", n.ChatId, "reason", n.Reason)
+	return nil
+}
+
+type webhookNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// NewWebhookNotifier posts the notification as JSON.
+func NewWebhookNotifier(client *http.Client, url string) Notifier {
+	return &webhookNotifier{client: client, url: url}
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.client, w.url, n)
+}
+
+type telegramNotifier struct {
+	client *http.Client
+	url    string
+	chatId string
+}
+
+// NewTelegramNotifier uses the sendMessage method of the Telegram Bot API or
+// a compatible server at apiUrl.
+func NewTelegramNotifier(client *http.Client, apiUrl, token, chatId string) Notifier {
+	return &telegramNotifier{
+		client: client,
+		url:    fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(apiUrl, "/"), token),
+		chatId: chatId,
+	}
+}
+
+func (t *telegramNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, t.client, t.url, map[string]string{
+		"chat_id": t.chatId,
+		"text":    n.text(),
+	})
+}
+
+type smtpNotifier struct {
+	addr     string
+	user     string
+	password string
+	from     string
+	to       []string
+}
+
+// NewSMTPNotifier mails the notification to the comma separated recipients.
+// PLAIN authentication is used when a user is set.
+func NewSMTPNotifier(addr, user, password, from, to string) Notifier {
+	recipients := []string{}
+	for _, r := range strings.Split(to, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+
+	return &smtpNotifier{
+		addr:     addr,
+		user:     user,
+		password: password,
+		from:     from,
+		to:       recipients,
+	}
+}
+
+func (s *smtpNotifier) Notify(ctx context.Context, n Notification) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Avito: chat %s needs a manager\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.from, strings.Join(s.to, ", "), n.ChatId, n.text())
+
+	if err := s.send(ctx, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// send does what smtp.SendMail does, STARTTLS when offered and PLAIN auth
+// when a user is set, on a connection bounded by ctx and notifyTimeout.
+func (s *smtpNotifier) send(ctx context.Context, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	host, _, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return err
+	}
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.user != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.user, s.password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+
+	req, err := stdhttp.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if _, err := client.Do(ctx, req); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	return nil
+}
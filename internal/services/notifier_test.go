@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/http"
+)
+
+func TestSMTPNotifierGivesUpOnHungServer(t *testing.T) {
+	// accepts the connection and never sends the greeting
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		<-done
+		conn.Close()
+	}()
+
+	notifier := NewSMTPNotifier(listener.Addr().String(), "", "", "bot@example.com", "manager@example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := notifier.Notify(ctx, Notification{ChatId: "c1"}); err == nil {
+		t.Fatal("Notify succeeded against a silent server")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Notify took %s, want it bounded by ctx", elapsed)
+	}
+}
+
+func TestWebhookNotifierUsesContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := http.NewClient(&stdhttp.Client{}, nil, http.RetryConfig{})
+	notifier := NewWebhookNotifier(client, server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := notifier.Notify(ctx, Notification{ChatId: "c1"}); err == nil {
+		t.Fatal("Notify succeeded against a hung server")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Notify took %s, want it bounded by ctx", elapsed)
+	}
+}
@@ -1,77 +1,127 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
 
 	"github.com/mngn84/avito-cons/internal/config"
 	"github.com/mngn84/avito-cons/internal/models/avito_models"
-	"github.com/mngn84/avito-cons/internal/storage/pg"
+	"github.com/mngn84/avito-cons/internal/models/openai_models"
+	"github.com/mngn84/avito-cons/internal/storage"
 )
 
 type OpenAIService interface {
-	GetResponse(text string, chatId string, userId int, created int, itemInfo avito_models.Value) (string, error)
-	UploadFileToVectorStore(file io.Reader, fileName, profileName, fileType string) (string, error)
+	GetResponse(ctx context.Context, profile *storage.Profile, text string, images [][]byte, chatId string, msgId string, itemInfo avito_models.Value) (Response, error)
+	UploadFileToVectorStore(ctx context.Context, file io.Reader, fileName, profileName, fileType string) (string, error)
+}
+
+// Response is the outcome of an assistant run. Text may be empty when the
+// assistant only escalated the chat.
+type Response struct {
+	Text       string
+	Escalation *Escalation
+
+	// empty for the chat backend
+	ThreadId string
+	RunId    string
+	Usage    Usage
+}
+
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+func (u *Usage) add(usage openai.Usage) {
+	u.PromptTokens += usage.PromptTokens
+	u.CompletionTokens += usage.CompletionTokens
+	u.TotalTokens += usage.TotalTokens
 }
 
 type openaiService struct {
-	client *http.Client
-	config *config.Config
-	logger *slog.Logger
-	db     *pg.PgClient
-	openai *openai.Client
-	ctx    context.Context
+	client   openai.HTTPDoer
+	stream   *http.Client
+	config   *config.Config
+	logger   *slog.Logger
+	db       storage.AssistantStore
+	profiles ProfileService
+	openai   *openai.Client
+	tools    *ToolRegistry
 }
 
-func NewOpenAIService(config *config.Config, logger *slog.Logger, db *pg.PgClient) OpenAIService {
-	ctx := context.Background()
+func NewOpenAIService(config *config.Config, logger *slog.Logger, db storage.AssistantStore, profiles ProfileService, tools *ToolRegistry, clientConfig openai.ClientConfig) OpenAIService {
 	return &openaiService{
-		client: &http.Client{},
-		config: config,
-		logger: logger,
-		db:     db,
-		openai: openai.NewClient(config.OpenAI.ApiKey),
-		ctx:    ctx,
+		client:   clientConfig.HTTPClient,
+		stream:   streamClient(clientConfig),
+		config:   config,
+		logger:   logger,
+		db:       db,
+		profiles: profiles,
+		openai:   openai.NewClientWithConfig(clientConfig),
+		tools:    tools,
 	}
 }
 
-func (s *openaiService) GetResponse(text string, chatId string, userId int, created int, itemInfo avito_models.Value) (string, error) {
-	asstId, err := s.getAssistantId(userId)
+func (s *openaiService) GetResponse(ctx context.Context, profile *storage.Profile, text string, images [][]byte, chatId string, msgId string, itemInfo avito_models.Value) (Response, error) {
+	asstId, err := s.getAssistantId(ctx, profile.UserId)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
-	threadId, isNew, err := s.getOrCreateThread(chatId, asstId)
+	threadId, isNew, err := s.getOrCreateThread(ctx, chatId, asstId)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
-	err = s.sendMessageToThread(threadId, text, itemInfo, isNew)
+	imageIds, err := s.sendMessageToThread(ctx, threadId, text, images, itemInfo, isNew)
+	// the uploads are only read by this run
+	defer s.deleteImages(ctx, imageIds)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
-	runId, err := s.runAssistant(threadId, asstId)
-	if err != nil {
-		return "", err
+	toolCtx := &ToolContext{
+		Profile:  profile,
+		ChatId:   chatId,
+		Item:     itemInfo,
+		Response: &Response{ThreadId: threadId},
+	}
+
+	// one OPENAI_TIMEOUT for the whole run, however it is followed
+	ctx, cancel := context.WithTimeout(ctx, s.config.OpenAI.Timeout)
+	defer cancel()
+
+	if s.config.OpenAI.Stream {
+		res, err := s.streamResponse(ctx, threadId, s.runRequest(asstId, profile), toolCtx)
+		if !errors.Is(err, errStreamUnavailable) {
+			return res, err
+		}
+		s.logger.Warn("streaming is unavailable, polling the run", "error", err)
 	}
 
-	res, err := s.waitForResponse(threadId, runId)
+	runId, err := s.runAssistant(ctx, threadId, asstId, profile)
 	if err != nil {
-		return "", err
+		return Response{}, err
 	}
 
-	return res, nil
+	return s.waitForResponse(ctx, threadId, runId, toolCtx)
 }
 
-func (s *openaiService) getAssistantId(userId int) (string, error) {
-	asstId, err := s.db.GetAssistantId(userId)
+func (s *openaiService) getAssistantId(ctx context.Context, userId int) (string, error) {
+	asstId, err := s.db.GetAssistantId(ctx, userId)
 	if err != nil || asstId == "" {
 		return "", fmt.Errorf("failed to get assistant id: %w", err)
 	}
@@ -79,43 +129,159 @@ func (s *openaiService) getAssistantId(userId int) (string, error) {
 	return asstId, nil
 }
 
-func (s *openaiService) getOrCreateThread(chatId, asstId string) (string, bool, error) {
-	threadId, err := s.db.GetThreadId(chatId)
+func (s *openaiService) getOrCreateThread(ctx context.Context, chatId, asstId string) (string, bool, error) {
+	threadId, err := s.db.GetThreadId(ctx, chatId)
 	if err == nil && threadId != "" {
 		return threadId, false, nil
 	}
 
-	thread, err := s.openai.CreateThread(s.ctx, openai.ThreadRequest{})
+	thread, err := s.openai.CreateThread(ctx, openai.ThreadRequest{})
 	if err != nil {
 		s.logger.Error("failed to create thread", "error", err)
 		return "", false, err
 	}
 
-	_ = s.db.SaveThreadId(chatId, thread.ID, asstId)
+	_ = s.db.SaveThreadId(ctx, chatId, thread.ID, asstId)
 	return thread.ID, true, nil
 }
 
-func (s *openaiService) sendMessageToThread(threadId, text string, itemInfo avito_models.Value, isNew bool) error {
+// sendMessageToThread returns the ids of the uploaded images, also when it
+// fails after uploading some.
+func (s *openaiService) sendMessageToThread(ctx context.Context, threadId, text string, images [][]byte, itemInfo avito_models.Value, isNew bool) ([]string, error) {
 	if isNew {
-		text = fmt.Sprintf("Сообщение по объявлению %s %s: %s", itemInfo.Title, itemInfo.PriceString, text)
+		text = strings.TrimSpace(fmt.Sprintf("Сообщение по объявлению %s %s: %s", itemInfo.Title, itemInfo.PriceString, text))
+	}
+
+	if len(images) > 0 {
+		return s.sendImageMessage(ctx, threadId, text, images)
 	}
-	_, err := s.openai.CreateMessage(s.ctx, threadId, openai.MessageRequest{
+
+	_, err := s.openai.CreateMessage(ctx, threadId, openai.MessageRequest{
 		Role:    "user",
 		Content: text,
 	})
 
 	if err != nil {
 		s.logger.Error("failed to create message", "error", err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	return nil, nil
+}
+
+// sendImageMessage uploads the pictures for vision and creates a message with
+// text and image parts. go-openai only supports plain text content here, so
+// the request is sent directly.
+func (s *openaiService) sendImageMessage(ctx context.Context, threadId, text string, images [][]byte) ([]string, error) {
+	parts := []openai_models.ContentPart{}
+	if text != "" {
+		parts = append(parts, openai_models.ContentPart{Type: "text", Text: text})
+	}
+
+	fileIds := []string{}
+	for _, image := range images {
+		fileId, err := s.uploadImage(ctx, image)
+		if err != nil {
+			return fileIds, err
+		}
+		fileIds = append(fileIds, fileId)
+		parts = append(parts, openai_models.ContentPart{
+			Type:      "image_file",
+			ImageFile: &openai_models.ImageFile{FileId: fileId},
+		})
+	}
+
+	payload, err := json.Marshal(openai_models.MessageRequest{Role: "user", Content: parts})
+	if err != nil {
+		return fileIds, fmt.Errorf("failed to marshal json: %w", err)
+	}
+
+	req, err := s.newApiRequest(ctx, fmt.Sprintf("/threads/%s/messages", threadId), payload)
+	if err != nil {
+		return fileIds, err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Error("failed to create message", "error", err)
+		return fileIds, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		s.logger.Error("failed to create message", "status", res.StatusCode, "body", string(body))
+		return fileIds, fmt.Errorf("failed to create message: status %d", res.StatusCode)
+	}
+
+	return fileIds, nil
+}
+
+// deleteImages removes vision uploads, they are kept by OpenAI until deleted.
+func (s *openaiService) deleteImages(ctx context.Context, fileIds []string) {
+	if len(fileIds) == 0 {
+		return
+	}
+
+	// also after the run was cancelled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	for _, fileId := range fileIds {
+		if err := s.openai.DeleteFile(ctx, fileId); err != nil && !isNotFound(err) {
+			s.logger.Error("failed to delete image", "error", err, "file_id", fileId)
+		}
+	}
+}
+
+// newApiRequest builds a POST to the Assistants API for the calls go-openai
+// does not cover.
+func (s *openaiService) newApiRequest(ctx context.Context, path string, payload []byte) (*http.Request, error) {
+	url := strings.TrimSuffix(s.config.OpenAI.ApiUrl, "/") + path
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.config.OpenAI.ApiKey)
+	req.Header.Set("OpenAI-Beta", "assistants=v2")
+
+	return req, nil
 }
 
-func (s *openaiService) runAssistant(threadId string, asstId string) (string, error) {
-	run, err := s.openai.CreateRun(s.ctx, threadId, openai.RunRequest{
-		AssistantID: asstId,
+func (s *openaiService) uploadImage(ctx context.Context, image []byte) (string, error) {
+	ext := ""
+	switch http.DetectContentType(image) {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/png":
+		ext = ".png"
+	case "image/gif":
+		ext = ".gif"
+	case "image/webp":
+		ext = ".webp"
+	default:
+		return "", fmt.Errorf("unsupported image type %q", http.DetectContentType(image))
+	}
+
+	file, err := s.openai.CreateFileBytes(ctx, openai.FileBytesRequest{
+		Name:    "image" + ext,
+		Bytes:   image,
+		Purpose: "vision",
 	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload image: %w", err)
+	}
+	s.logger.Info("image uploaded to openai", "file_id", file.ID)
+
+	return file.ID, nil
+}
+
+// runAssistant overrides the model and instructions stored on the assistant
+// with the current profile settings, so changes apply without recreating it.
+// Tools are overridden as well, assistants created earlier have none.
+func (s *openaiService) runAssistant(ctx context.Context, threadId string, asstId string, profile *storage.Profile) (string, error) {
+	run, err := s.openai.CreateRun(ctx, threadId, s.runRequest(asstId, profile))
 	if err != nil {
 		s.logger.Error("failed to create run", "error", err)
 		return "", err
@@ -123,76 +289,135 @@ func (s *openaiService) runAssistant(threadId string, asstId string) (string, er
 	return run.ID, nil
 }
 
-func (s *openaiService) waitForResponse(threadId string, runId string) (string, error) {
-	for {
-		res, err := s.openai.RetrieveRun(s.ctx, threadId, runId)
-		if err != nil {
-			return "", fmt.Errorf("failed to get run status: %w", err)
-		}
+func (s *openaiService) runRequest(asstId string, profile *storage.Profile) openai.RunRequest {
+	return openai.RunRequest{
+		AssistantID:  asstId,
+		Model:        profile.Model,
+		Instructions: profile.SystemPrompt,
+		Tools:        s.runTools(),
+	}
+}
+
+func (s *openaiService) runTools() []openai.Tool {
+	tools := []openai.Tool{{Type: openai.ToolType(openai.AssistantToolTypeFileSearch)}}
+	return append(tools, s.tools.Definitions()...)
+}
+
+func (s *openaiService) assistantTools() []openai.AssistantTool {
+	tools := []openai.AssistantTool{}
+	for _, tool := range s.runTools() {
+		tools = append(tools, openai.AssistantTool{
+			Type:     openai.AssistantToolType(tool.Type),
+			Function: tool.Function,
+		})
+	}
+	return tools
+}
 
-		switch res.Status {
-		case openai.RunStatusCompleted:
-			limit := 1
-			order := "desc"
+// lastRunMessage returns the text of the newest assistant message created by
+// the run, or an empty string when the run wrote none.
+func (s *openaiService) lastRunMessage(ctx context.Context, threadId string, runId string) (string, error) {
+	limit := 1
+	order := "desc"
 
-			msgs, err := s.openai.ListMessage(s.ctx, threadId, &limit, &order, nil, nil, nil)
-			if err != nil {
-				return "", fmt.Errorf("failed to get message: %w", err)
-			}
+	msgs, err := s.openai.ListMessage(ctx, threadId, &limit, &order, nil, nil, &runId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get message: %w", err)
+	}
 
-			if len(msgs.Messages) == 0 {
-				return "", fmt.Errorf("no messages found")
-			}
+	if len(msgs.Messages) == 0 || msgs.Messages[0].Role != openai.ChatMessageRoleAssistant {
+		return "", nil
+	}
 
-			return msgs.Messages[0].Content[0].Text.Value, nil
-		case openai.RunStatusFailed:
-			return "", fmt.Errorf("failed to run assistant")
+	for _, content := range msgs.Messages[0].Content {
+		if content.Text != nil {
+			return content.Text.Value, nil
 		}
-		time.Sleep(500 * time.Millisecond)
 	}
+
+	return "", nil
+}
+
+// submitToolOutputs executes the tools the run asked for and hands their
+// results back to it.
+func (s *openaiService) submitToolOutputs(ctx context.Context, threadId string, run openai.Run, toolCtx *ToolContext) error {
+	outputs, err := s.callTools(ctx, run, toolCtx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.openai.SubmitToolOutputs(ctx, threadId, run.ID, openai.SubmitToolOutputsRequest{
+		ToolOutputs: outputs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to submit tool outputs: %w", err)
+	}
+
+	return nil
+}
+
+func (s *openaiService) callTools(ctx context.Context, run openai.Run, toolCtx *ToolContext) ([]openai.ToolOutput, error) {
+	if run.RequiredAction == nil || run.RequiredAction.SubmitToolOutputs == nil {
+		return nil, fmt.Errorf("run requires an unsupported action")
+	}
+
+	outputs := []openai.ToolOutput{}
+	for _, call := range run.RequiredAction.SubmitToolOutputs.ToolCalls {
+		s.logger.Info("calling tool", "tool", call.Function.Name, "chat_id", toolCtx.ChatId)
+		outputs = append(outputs, openai.ToolOutput{
+			ToolCallID: call.ID,
+			Output:     s.tools.Call(ctx, toolCtx, call.Function.Name, call.Function.Arguments),
+		})
+	}
+
+	return outputs, nil
 }
 
-func (s *openaiService) UploadFileToVectorStore(file io.Reader, fileName, profileName, fileType string) (string, error) {
+func (s *openaiService) UploadFileToVectorStore(ctx context.Context, file io.Reader, fileName, profileName, fileType string) (string, error) {
 	s.logger.Info("Uploading file to vector store")
 
-	userId, err := s.db.GetUserId(profileName)
+	userId, err := s.db.GetUserId(ctx, profileName)
 	if err != nil {
 		return "", fmt.Errorf("failed to get user id: %w", err)
 	}
 
-	asstId, err := s.getAssistantId(userId)
+	asstId, err := s.getAssistantId(ctx, userId)
 	if err != nil || asstId == "" {
-		asstId, err = s.createAssistant(userId, profileName)
+		asstId, err = s.createAssistant(ctx, userId, profileName)
 		if err != nil {
 			return "", fmt.Errorf("failed to create assistant: %w", err)
 		}
 	}
 
-	storeId, err := s.db.GetStoreId(asstId)
+	storeId, err := s.db.GetStoreId(ctx, asstId)
 	if err != nil || storeId == "" {
 		s.logger.Info("Vector store not found")
-		storeId, err = s.createVectorStore(asstId, profileName)
+		storeId, err = s.createVectorStore(ctx, asstId, profileName)
 		if err != nil {
 			return "", fmt.Errorf("failed to create vector store: %w", err)
 		}
 	}
 	s.logger.Info("Vector store", "store_id", storeId)
 
-	oldFileId, err := s.db.GetOldFileId(storeId, fileName, fileType)
-
-	if err == nil && oldFileId != "" {
-		err = s.deleteOldFile(storeId, oldFileId)
-		if err != nil {
-			return "", fmt.Errorf("failed to delete old file: %w", err)
-		}
-	}
-
 	fileBytes, err := io.ReadAll(file)
 	if err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
+	hash := sha256.Sum256(fileBytes)
+	contentHash := hex.EncodeToString(hash[:])
 
-	fileResp, err := s.openai.CreateFileBytes(s.ctx, openai.FileBytesRequest{
+	oldFiles, err := s.db.GetFiles(ctx, storeId, fileName, fileType)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file records: %w", err)
+	}
+	for _, old := range oldFiles {
+		if old.ContentHash == contentHash && old.Status == storage.FileStatusCompleted {
+			s.logger.Info("File is already in vector store", "file_id", old.FileId)
+			return old.FileId, nil
+		}
+	}
+
+	fileResp, err := s.openai.CreateFileBytes(ctx, openai.FileBytesRequest{
 		Name:    fileName,
 		Bytes:   fileBytes,
 		Purpose: "assistants",
@@ -203,28 +428,56 @@ func (s *openaiService) UploadFileToVectorStore(file io.Reader, fileName, profil
 	fileId := fileResp.ID
 	s.logger.Info("File uploaded to openai", "file_id", fileId)
 
-	err = s.addFileToStore(fileId, fileName, fileType, storeId)
+	err = s.db.SaveFileRecord(ctx, storage.File{
+		FileId:      fileId,
+		StoreId:     storeId,
+		Name:        fileName,
+		Type:        fileType,
+		ContentHash: contentHash,
+		Size:        int64(len(fileBytes)),
+		Status:      storage.FileStatusUploaded,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save file record: %w", err)
+	}
+
+	err = s.addFileToStore(ctx, fileId, storeId)
 	if err != nil {
+		if delErr := s.deleteFile(ctx, storage.File{FileId: fileId, StoreFileId: fileId, StoreId: storeId}); delErr != nil {
+			s.logger.Error("failed to clean up file", "error", delErr, "file_id", fileId)
+		}
 		return "", err
 	}
 
+	// replaced only once the new version is in the store
+	for _, old := range oldFiles {
+		if err := s.deleteFile(ctx, old); err != nil {
+			s.logger.Error("failed to delete old file", "error", err, "file_id", old.FileId)
+		}
+	}
+
 	return fileId, nil
 }
 
-func (s *openaiService) createAssistant(userId int, profileName string) (string, error) {
+func (s *openaiService) createAssistant(ctx context.Context, userId int, profileName string) (string, error) {
 	s.logger.Info("Creating assistant")
 
-	asstId, err := s.getAssistantId(userId)
+	asstId, err := s.getAssistantId(ctx, userId)
 	if err == nil && asstId != "" {
 		return "", err
 	}
 
+	profile, err := s.profiles.Get(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
 	asstName := fmt.Sprintf("%s-asst", profileName)
-	asst, err := s.openai.CreateAssistant(s.ctx, openai.AssistantRequest{
-		Model:        s.config.OpenAI.Model,
+	asst, err := s.openai.CreateAssistant(ctx, openai.AssistantRequest{
+		Model:        profile.Model,
 		Name:         &asstName,
-		Instructions: &s.config.OpenAI.SystemPrompt,
-		//tools: ????
+		Instructions: &profile.SystemPrompt,
+		Tools:        s.assistantTools(),
 	})
 
 	if err != nil {
@@ -232,22 +485,22 @@ func (s *openaiService) createAssistant(userId int, profileName string) (string,
 		return "", err
 	}
 
-	_ = s.db.SaveAssistant(asst.ID, *asst.Name, userId)
+	_ = s.db.SaveAssistant(ctx, asst.ID, *asst.Name, userId)
 	return asst.ID, nil
 }
 
-func (s *openaiService) createVectorStore(asstId, profileName string) (string, error) {
+func (s *openaiService) createVectorStore(ctx context.Context, asstId, profileName string) (string, error) {
 	storeName := fmt.Sprintf("vector-store_%s", profileName)
 	s.logger.Info("Creating vector store", "store_name", storeName)
 
-	store, err := s.openai.CreateVectorStore(s.ctx, openai.VectorStoreRequest{
+	store, err := s.openai.CreateVectorStore(ctx, openai.VectorStoreRequest{
 		Name: storeName,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to create vector store: %w", err)
 	}
 
-	err = s.db.SaveStoreRecord(store.ID, store.Name, asstId)
+	err = s.db.SaveStoreRecord(ctx, store.ID, store.Name, asstId)
 	if err != nil {
 		return "", fmt.Errorf("failed to save vector store id: %w", err)
 	}
@@ -255,36 +508,68 @@ func (s *openaiService) createVectorStore(asstId, profileName string) (string, e
 	return store.ID, nil
 }
 
-func (s *openaiService) addFileToStore(fileId, fileName, fileType, storeId string) error {
+func (s *openaiService) addFileToStore(ctx context.Context, fileId, storeId string) error {
 	s.logger.Info("Adding file to vector store", "file_id", fileId)
 
-	file, err := s.openai.CreateVectorStoreFile(s.ctx, storeId, openai.VectorStoreFileRequest{
+	file, err := s.openai.CreateVectorStoreFile(ctx, storeId, openai.VectorStoreFileRequest{
 		FileID: fileId,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to add file to vector store: %w", err)
 	}
 
-	err = s.db.SaveFileRecord(file.ID, fileName, fileType, file.VectorStoreID)
+	// wait for the indexing so the record ends up completed or failed; a
+	// file still in progress after OPENAI_TIMEOUT is kept as it is
+	pollCtx, cancel := context.WithTimeout(ctx, s.config.OpenAI.Timeout)
+	defer cancel()
+	delay := s.config.OpenAI.PollInterval
+	for file.Status == "in_progress" {
+		timer := time.NewTimer(delay)
+		select {
+		case <-pollCtx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if pollCtx.Err() != nil {
+			break
+		}
+		delay = min(delay*2, s.config.OpenAI.PollMaxInterval)
+
+		res, err := s.openai.RetrieveVectorStoreFile(pollCtx, storeId, file.ID)
+		if err != nil {
+			s.logger.Error("failed to get vector store file", "error", err, "file_id", fileId)
+			break
+		}
+		file = res
+	}
+
+	err = s.db.UpdateFileStatus(ctx, fileId, file.ID, file.Status)
 	if err != nil {
-		return fmt.Errorf("failed to save file id: %w", err)
+		return fmt.Errorf("failed to update file record: %w", err)
+	}
+	if file.Status == storage.FileStatusFailed {
+		return fmt.Errorf("vector store failed to process file %s", fileId)
 	}
 
 	return nil
 }
 
-func (s *openaiService) deleteOldFile(storeId, fileId string) error {
-	err := s.openai.DeleteVectorStoreFile(s.ctx, storeId, fileId)
-	if err != nil {
-		return fmt.Errorf("failed to delete vector store files: %w", err)
+// deleteFile removes the file from the vector store, OpenAI and the registry.
+// Files already gone at OpenAI are only removed from the registry.
+func (s *openaiService) deleteFile(ctx context.Context, file storage.File) error {
+	if file.StoreFileId != "" {
+		err := s.openai.DeleteVectorStoreFile(ctx, file.StoreId, file.StoreFileId)
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("failed to delete vector store file: %w", err)
+		}
 	}
 
-	err = s.openai.DeleteFile(s.ctx, fileId)
-	if err != nil {
+	err := s.openai.DeleteFile(ctx, file.FileId)
+	if err != nil && !isNotFound(err) {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
-	err = s.db.DeleteOldFile(storeId, fileId)
+	err = s.db.DeleteFileRecord(ctx, file.FileId)
 	if err != nil {
 		return fmt.Errorf("failed to delete file record: %w", err)
 	}
@@ -292,9 +577,21 @@ func (s *openaiService) deleteOldFile(storeId, fileId string) error {
 	return nil
 }
 
+func isNotFound(err error) bool {
+	apiErr := &openai.APIError{}
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusNotFound
+	}
+	reqErr := &openai.RequestError{}
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == http.StatusNotFound
+	}
+	return false
+}
+
 //удаление файлов из векторного хранилища
 /* func (s *openaiService) listVectorStores() (openai.VectorStoresList, error) {
-	stores, err := s.openai.ListVectorStores(s.ctx, nil, l)
+	stores, err := s.openai.ListVectorStores(ctx, nil, l)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list vector stores: %w", err)
 	}
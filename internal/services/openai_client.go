@@ -0,0 +1,105 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/mngn84/avito-cons/internal/config"
+)
+
+// NewOpenAIClientConfig builds the go-openai configuration shared by every
+// OpenAI client: OPENAI_URL, organization and project headers, proxy, extra
+// CA bundle and the per request timeout. Its HTTPClient is a *http.Client and
+// is also used for the raw Assistants API calls.
+func NewOpenAIClientConfig(config *config.Config) (openai.ClientConfig, error) {
+	transport, err := newTransport(config)
+	if err != nil {
+		return openai.ClientConfig{}, err
+	}
+
+	clientConfig := openai.DefaultConfig(config.OpenAI.ApiKey)
+	clientConfig.BaseURL = strings.TrimSuffix(config.OpenAI.ApiUrl, "/")
+	clientConfig.HTTPClient = &http.Client{
+		// go-openai only knows the organization header, the transport sets
+		// both so the raw requests get them too
+		Transport: &headerTransport{
+			base:         transport,
+			organization: config.OpenAI.Organization,
+			project:      config.OpenAI.Project,
+		},
+		Timeout: config.OpenAI.RequestTimeout,
+	}
+
+	return clientConfig, nil
+}
+
+// newTransport applies OPENAI_PROXY_URL and OPENAI_CA_FILE to a copy of the
+// default transport.
+func newTransport(config *config.Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.OpenAI.ProxyUrl != "" {
+		proxy, err := url.Parse(config.OpenAI.ProxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if config.OpenAI.CAFile != "" {
+		pem, err := os.ReadFile(config.OpenAI.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.OpenAI.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return transport, nil
+}
+
+// streamClient is the client without the request timeout: a stream stays
+// open for the whole run and is bounded by OPENAI_TIMEOUT instead.
+func streamClient(clientConfig openai.ClientConfig) *http.Client {
+	client, ok := clientConfig.HTTPClient.(*http.Client)
+	if !ok {
+		return &http.Client{}
+	}
+	stream := *client
+	stream.Timeout = 0
+	return &stream
+}
+
+type headerTransport struct {
+	base         http.RoundTripper
+	organization string
+	project      string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.organization == "" && t.project == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	if t.organization != "" {
+		req.Header.Set("OpenAI-Organization", t.organization)
+	}
+	if t.project != "" {
+		req.Header.Set("OpenAI-Project", t.project)
+	}
+	return t.base.RoundTrip(req)
+}
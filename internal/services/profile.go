@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+var ErrUnknownProfile = errors.New("unknown avito account")
+
+type ProfileService interface {
+	Get(ctx context.Context, userId int) (*storage.Profile, error)
+	List(ctx context.Context) ([]storage.Profile, error)
+}
+
+type cachedProfile struct {
+	profile  *storage.Profile
+	loadedAt time.Time
+}
+
+type profileService struct {
+	db     storage.ProfileRepo
+	config *config.Config
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	cache map[int]cachedProfile
+}
+
+func NewProfileService(config *config.Config, logger *slog.Logger, db storage.ProfileRepo) ProfileService {
+	return &profileService{
+		db:     db,
+		config: config,
+		logger: logger,
+		cache:  map[int]cachedProfile{},
+	}
+}
+
+// Get returns the account settings with empty fields filled from the global
+// config. Accounts missing from the profiles table are served with the global
+// settings only when global Avito credentials are configured.
+func (s *profileService) Get(ctx context.Context, userId int) (*storage.Profile, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[userId]
+	s.mu.Unlock()
+
+	if ok && time.Since(cached.loadedAt) < s.config.Avito.ProfileCacheTTL {
+		return cached.profile, nil
+	}
+
+	profile, err := s.db.GetProfile(ctx, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profile: %w", err)
+	}
+
+	if profile == nil {
+		if s.config.Avito.Token == "" && s.config.Avito.ClientId == "" {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownProfile, userId)
+		}
+		profile = &storage.Profile{UserId: userId}
+	}
+	s.applyDefaults(profile)
+
+	s.mu.Lock()
+	s.cache[userId] = cachedProfile{profile: profile, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return profile, nil
+}
+
+func (s *profileService) List(ctx context.Context) ([]storage.Profile, error) {
+	profiles, err := s.db.ListProfiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profiles: %w", err)
+	}
+
+	for i := range profiles {
+		s.applyDefaults(&profiles[i])
+	}
+
+	return profiles, nil
+}
+
+func (s *profileService) applyDefaults(p *storage.Profile) {
+	if p.ClientId == "" || p.ClientSecret == "" {
+		p.ClientId = s.config.Avito.ClientId
+		p.ClientSecret = s.config.Avito.ClientSecret
+	}
+	if p.SystemPrompt == "" {
+		p.SystemPrompt = s.config.OpenAI.SystemPrompt
+	}
+	if p.Model == "" {
+		p.Model = s.config.OpenAI.Model
+	}
+	if p.SendMode == "" {
+		p.SendMode = s.config.Avito.SendMode
+	}
+	if p.Backend == "" {
+		p.Backend = s.config.OpenAI.Backend
+	}
+	if p.Provider == "" {
+		p.Provider = s.config.LLM.Provider
+	}
+	if p.CompatibleUrl == "" {
+		p.CompatibleUrl = s.config.LLM.CompatibleUrl
+	}
+	if p.WebhookAuth == "" {
+		p.WebhookAuth = s.config.Webhook.Auth
+	}
+	if p.WebhookSecret == "" {
+		p.WebhookSecret = s.config.Webhook.Secret
+	}
+	if p.WebhookIPs == "" {
+		p.WebhookIPs = s.config.Webhook.AllowedIPs
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/mngn84/avito-cons/internal/config"
+)
+
+const (
+	ProviderOpenAI = "openai"
+	// any server with the OpenAI Chat Completions API: Ollama, vLLM, LM Studio
+	ProviderCompatible = "compatible"
+	ProviderFake       = "fake"
+)
+
+type ChatMessage struct {
+	Role    string
+	Content string
+	Images  [][]byte
+	// set on assistant messages requesting tools
+	ToolCalls []ToolCall
+	// set on tool results
+	ToolCallId string
+}
+
+type ToolCall struct {
+	Id        string
+	Name      string
+	Arguments string
+}
+
+type ToolDefinition struct {
+	Name        string
+	Description string
+	// JSON schema of the arguments
+	Parameters any
+}
+
+type CompletionRequest struct {
+	Model       string
+	Messages    []ChatMessage
+	Tools       []ToolDefinition
+	Temperature float32
+	// server of the compatible provider, the others ignore it
+	BaseUrl string
+}
+
+type CompletionResult struct {
+	Message ChatMessage
+	Usage   Usage
+}
+
+// Provider is a chat model backend. Implementations only translate the
+// request, tool execution and history are handled by the caller.
+type Provider interface {
+	Complete(ctx context.Context, req CompletionRequest) (CompletionResult, error)
+}
+
+type openaiProvider struct {
+	client *openai.Client
+}
+
+// NewOpenAIProvider talks to OpenAI with the shared client configuration.
+func NewOpenAIProvider(clientConfig openai.ClientConfig) Provider {
+	return &openaiProvider{client: openai.NewClientWithConfig(clientConfig)}
+}
+
+type compatibleProvider struct {
+	apiKey     string
+	httpClient *http.Client
+
+	mu sync.Mutex
+	// by base url, every profile may use its own server
+	clients map[string]*openaiProvider
+}
+
+// NewCompatibleProvider talks to an OpenAI-compatible server at the url of
+// the profile, LLM_COMPATIBLE_URL by default; most of them ignore the API
+// key. Requests go through the proxy, CA bundle and timeout of OpenAI.
+func NewCompatibleProvider(config *config.Config) (Provider, error) {
+	transport, err := newTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compatibleProvider{
+		apiKey:     config.LLM.CompatibleApiKey,
+		httpClient: &http.Client{Transport: transport, Timeout: config.OpenAI.RequestTimeout},
+		clients:    map[string]*openaiProvider{},
+	}, nil
+}
+
+func (p *compatibleProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResult, error) {
+	if req.BaseUrl == "" {
+		return CompletionResult{}, fmt.Errorf("no url of the compatible provider")
+	}
+	return p.client(req.BaseUrl).Complete(ctx, req)
+}
+
+func (p *compatibleProvider) client(baseUrl string) *openaiProvider {
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	client, ok := p.clients[baseUrl]
+	if !ok {
+		clientConfig := openai.DefaultConfig(p.apiKey)
+		clientConfig.BaseURL = baseUrl
+		clientConfig.HTTPClient = p.httpClient
+		client = &openaiProvider{client: openai.NewClientWithConfig(clientConfig)}
+		p.clients[baseUrl] = client
+	}
+	return client
+}
+
+func (p *openaiProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResult, error) {
+	request := openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Temperature: req.Temperature,
+	}
+	for _, msg := range req.Messages {
+		request.Messages = append(request.Messages, toOpenAIMessage(msg))
+	}
+	for _, tool := range req.Tools {
+		request.Tools = append(request.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	res, err := p.client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return CompletionResult{}, fmt.Errorf("failed to create chat completion: %w", err)
+	}
+	if len(res.Choices) == 0 {
+		return CompletionResult{}, fmt.Errorf("no choices in chat completion")
+	}
+
+	msg := res.Choices[0].Message
+	result := CompletionResult{
+		Message: ChatMessage{Role: msg.Role, Content: msg.Content},
+	}
+	result.Usage.add(res.Usage)
+	for _, call := range msg.ToolCalls {
+		result.Message.ToolCalls = append(result.Message.ToolCalls, ToolCall{
+			Id:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+
+	return result, nil
+}
+
+func toOpenAIMessage(msg ChatMessage) openai.ChatCompletionMessage {
+	res := openai.ChatCompletionMessage{
+		Role:       msg.Role,
+		ToolCallID: msg.ToolCallId,
+	}
+	for _, call := range msg.ToolCalls {
+		res.ToolCalls = append(res.ToolCalls, openai.ToolCall{
+			ID:   call.Id,
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Name,
+				Arguments: call.Arguments,
+			},
+		})
+	}
+
+	if len(msg.Images) == 0 {
+		res.Content = msg.Content
+		return res
+	}
+
+	if msg.Content != "" {
+		res.MultiContent = append(res.MultiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: msg.Content})
+	}
+	for _, image := range msg.Images {
+		url := fmt.Sprintf("data:%s;base64,%s", http.DetectContentType(image), base64.StdEncoding.EncodeToString(image))
+		res.MultiContent = append(res.MultiContent, openai.ChatMessagePart{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: url},
+		})
+	}
+	return res
+}
+
+type fakeProvider struct {
+	reply string
+}
+
+// NewFakeProvider answers without any model: with LLM_FAKE_REPLY when set,
+// otherwise by echoing the last customer message. It never calls tools.
+func NewFakeProvider(config *config.Config) Provider {
+	return &fakeProvider{reply: config.LLM.FakeReply}
+}
+
+func (p *fakeProvider) Complete(ctx context.Context, req CompletionRequest) (CompletionResult, error) {
+	reply := p.reply
+	if reply == "" {
+		last := ""
+		for _, msg := range req.Messages {
+			if msg.Role == openai.ChatMessageRoleUser {
+				last = msg.Content
+				if last == "" && len(msg.Images) > 0 {
+					last = "[фото]"
+				}
+			}
+		}
+		reply = "echo: " + last
+	}
+
+	return CompletionResult{
+		Message: ChatMessage{Role: openai.ChatMessageRoleAssistant, Content: reply},
+	}, nil
+}
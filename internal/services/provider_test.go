@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+)
+
+// newCompletionServer answers every chat completion with its name.
+func newCompletionServer(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, name)
+	}))
+}
+
+func TestCompatibleProviderUsesProfileUrl(t *testing.T) {
+	first := newCompletionServer("first")
+	defer first.Close()
+	second := newCompletionServer("second")
+	defer second.Close()
+
+	provider, err := NewCompatibleProvider(&config.Config{OpenAI: config.OpenAIConfig{RequestTimeout: time.Second}})
+	if err != nil {
+		t.Fatalf("NewCompatibleProvider: %v", err)
+	}
+
+	for _, server := range []struct {
+		url  string
+		want string
+	}{
+		{first.URL + "/", "first"},
+		{second.URL, "second"},
+		{first.URL, "first"},
+	} {
+		res, err := provider.Complete(context.Background(), CompletionRequest{Model: "llama", BaseUrl: server.url})
+		if err != nil {
+			t.Fatalf("Complete %s: %v", server.url, err)
+		}
+		if res.Message.Content != server.want {
+			t.Fatalf("Complete %s = %q, want %q", server.url, res.Message.Content, server.want)
+		}
+	}
+}
+
+func TestCompatibleProviderRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	provider, err := NewCompatibleProvider(&config.Config{OpenAI: config.OpenAIConfig{RequestTimeout: 100 * time.Millisecond}})
+	if err != nil {
+		t.Fatalf("NewCompatibleProvider: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := provider.Complete(context.Background(), CompletionRequest{Model: "llama", BaseUrl: server.URL}); err == nil {
+		t.Fatal("Complete succeeded against a hung server")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Complete took %s, want it bounded by OPENAI_REQUEST_TIMEOUT", elapsed)
+	}
+}
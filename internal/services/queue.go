@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+var ErrDuplicateMessage = errors.New("message already received")
+
+type MessageHandler func(ctx context.Context, msg *handlers_models.FromAvitoMsg) error
+
+type QueueService interface {
+	Enqueue(ctx context.Context, msg *handlers_models.FromAvitoMsg) error
+	Start(ctx context.Context, handler MessageHandler)
+	Wait()
+}
+
+type queueService struct {
+	db     storage.QueueRepo
+	config *config.Config
+	logger *slog.Logger
+	wg     sync.WaitGroup
+}
+
+func NewQueueService(config *config.Config, logger *slog.Logger, db storage.QueueRepo) QueueService {
+	return &queueService{
+		db:     db,
+		config: config,
+		logger: logger,
+	}
+}
+
+func (s *queueService) Enqueue(ctx context.Context, msg *handlers_models.FromAvitoMsg) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	queued, err := s.db.EnqueueJob(ctx, msg.Id, msg.UserId, msg.ChatId, payload, s.config.Queue.MaxAttempts)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue message: %w", err)
+	}
+	if !queued {
+		return ErrDuplicateMessage
+	}
+
+	s.logger.Info("message enqueued", "msg_id", msg.Id, "chat_id", msg.ChatId)
+	return nil
+}
+
+// Start runs a dispatcher that leases jobs and a pool of workers that process
+// them. When ctx is cancelled no new jobs are leased and the handlers of the
+// running jobs see it cancelled too; their jobs are released for a retry,
+// Wait blocks until that happens.
+func (s *queueService) Start(ctx context.Context, handler MessageHandler) {
+	jobs := make(chan storage.Job)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(jobs)
+		s.dispatch(ctx, jobs)
+	}()
+
+	for i := 0; i < s.config.Queue.Workers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for job := range jobs {
+				s.process(ctx, job, handler)
+			}
+		}()
+	}
+}
+
+func (s *queueService) Wait() {
+	s.wg.Wait()
+}
+
+func (s *queueService) dispatch(ctx context.Context, jobs chan<- storage.Job) {
+	host, _ := os.Hostname()
+	workerId := fmt.Sprintf("%s-%d", host, os.Getpid())
+
+	ticker := time.NewTicker(s.config.Queue.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		leased, err := s.db.LeaseJobs(ctx, workerId, s.config.Queue.Workers, s.config.Queue.LeaseDuration)
+		if err != nil {
+			s.logger.Error("failed to lease jobs", "error", err)
+		}
+
+		for _, job := range leased {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				// the lease expires and another worker picks the job up
+				return
+			}
+		}
+
+		if len(leased) == s.config.Queue.Workers {
+			// a full batch means there is probably more work waiting
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *queueService) process(ctx context.Context, job storage.Job, handler MessageHandler) {
+	// the job is settled even when the handler was cut off by a shutdown
+	dbCtx := context.WithoutCancel(ctx)
+	logger := s.logger.With("job_id", job.Id, "chat_id", job.ChatId, "attempt", job.Attempts)
+
+	if job.Attempts > job.MaxAttempts {
+		logger.Error("job lease expired too many times, moving to dead letter")
+		if err := s.db.DeadJob(dbCtx, job.Id, "lease expired too many times"); err != nil {
+			logger.Error("failed to dead-letter job", "error", err)
+		}
+		return
+	}
+
+	msg := handlers_models.FromAvitoMsg{}
+	if err := json.Unmarshal(job.Payload, &msg); err != nil {
+		logger.Error("failed to decode job payload", "error", err)
+		if err := s.db.DeadJob(dbCtx, job.Id, err.Error()); err != nil {
+			logger.Error("failed to dead-letter job", "error", err)
+		}
+		return
+	}
+
+	s.setEventState(dbCtx, msg.Id, storage.EventProcessing)
+
+	if err := handler(ctx, &msg); err != nil {
+		delay := s.config.Queue.RetryDelay * time.Duration(1<<min(job.Attempts-1, 10))
+		if ctx.Err() != nil {
+			// shutting down, another instance may pick it up right away
+			delay = 0
+		}
+		status, dbErr := s.db.FailJob(dbCtx, job.Id, err.Error(), delay)
+		if dbErr != nil {
+			logger.Error("failed to release job", "error", dbErr)
+			return
+		}
+		logger.Error("failed to process job", "error", err, "status", status, "retry_in", delay)
+		if status == storage.JobDead {
+			s.setEventState(dbCtx, msg.Id, storage.EventFailed)
+		}
+		return
+	}
+
+	if err := s.db.CompleteJob(dbCtx, job.Id); err != nil {
+		logger.Error("failed to complete job", "error", err)
+	}
+	s.setEventState(dbCtx, msg.Id, storage.EventDone)
+}
+
+func (s *queueService) setEventState(ctx context.Context, msgId, state string) {
+	if msgId == "" {
+		return
+	}
+	if err := s.db.SetEventState(ctx, msgId, state); err != nil {
+		s.logger.Error("failed to update message state", "error", err, "msg_id", msgId, "state", state)
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage/memory"
+)
+
+func TestQueueRetriesFailedJobs(t *testing.T) {
+	cfg := &config.Config{Queue: config.QueueConfig{
+		Workers:       2,
+		PollInterval:  5 * time.Millisecond,
+		LeaseDuration: time.Minute,
+		MaxAttempts:   3,
+		RetryDelay:    time.Millisecond,
+	}}
+	queue := NewQueueService(cfg, testLogger(), memory.NewStore())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msg := &handlers_models.FromAvitoMsg{Id: "m1", ChatId: "c1", UserId: 1}
+	if err := queue.Enqueue(ctx, msg); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if err := queue.Enqueue(ctx, msg); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("Enqueue of a redelivery = %v, want ErrDuplicateMessage", err)
+	}
+
+	mu := sync.Mutex{}
+	calls := 0
+	done := make(chan struct{})
+	queue.Start(ctx, func(ctx context.Context, msg *handlers_models.FromAvitoMsg) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		if calls == 1 {
+			return errors.New("temporary failure")
+		}
+		close(done)
+		return nil
+	})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the failed job was not retried")
+	}
+
+	cancel()
+	queue.Wait()
+
+	if calls != 2 {
+		t.Fatalf("handler called %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	ErrRunFailed     = errors.New("assistant run failed")
+	ErrRunExpired    = errors.New("assistant run expired")
+	ErrRunCancelled  = errors.New("assistant run cancelled")
+	ErrRunIncomplete = errors.New("assistant run incomplete")
+	ErrRunTimeout    = errors.New("assistant run timed out")
+)
+
+// RunError is returned for a run that ended without an answer. It matches
+// the Err* value of its terminal state with errors.Is.
+type RunError struct {
+	RunId   string
+	Status  openai.RunStatus
+	Code    string
+	Message string
+	err     error
+}
+
+func (e *RunError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: run %s", e.err, e.RunId)
+	}
+	return fmt.Sprintf("%s: run %s: %s %s", e.err, e.RunId, e.Code, e.Message)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.err
+}
+
+func newRunError(run openai.Run, err error) *RunError {
+	runErr := &RunError{RunId: run.ID, Status: run.Status, err: err}
+	if run.LastError != nil {
+		runErr.Code = string(run.LastError.Code)
+		runErr.Message = run.LastError.Message
+	}
+	return runErr
+}
+
+// waitForResponse polls the run with exponential backoff until it reaches a
+// terminal state, executing tool calls on the way. A run still going when ctx
+// is done is cancelled, otherwise it would keep the thread locked.
+func (s *openaiService) waitForResponse(ctx context.Context, threadId string, runId string, toolCtx *ToolContext) (Response, error) {
+	response := toolCtx.Response
+	response.RunId = runId
+	delay := s.config.OpenAI.PollInterval
+
+	for {
+		res, err := s.openai.RetrieveRun(ctx, threadId, runId)
+		if err != nil {
+			if ctx.Err() != nil {
+				return Response{}, s.cancelRun(ctx, threadId, runId)
+			}
+			return Response{}, fmt.Errorf("failed to get run status: %w", err)
+		}
+
+		switch res.Status {
+		case openai.RunStatusCompleted:
+			text, err := s.lastRunMessage(ctx, threadId, runId)
+			if err != nil {
+				return Response{}, err
+			}
+			if text == "" && response.Escalation == nil {
+				return Response{}, fmt.Errorf("no messages found")
+			}
+
+			response.Text = text
+			response.Usage.add(res.Usage)
+			return *response, nil
+		case openai.RunStatusRequiresAction:
+			if err := s.submitToolOutputs(ctx, threadId, res, toolCtx); err != nil {
+				if ctx.Err() != nil {
+					return Response{}, s.cancelRun(ctx, threadId, runId)
+				}
+				return Response{}, err
+			}
+			// the run continues right away, start polling fast again
+			delay = s.config.OpenAI.PollInterval
+			continue
+		case openai.RunStatusFailed:
+			return Response{}, newRunError(res, ErrRunFailed)
+		case openai.RunStatusExpired:
+			return Response{}, newRunError(res, ErrRunExpired)
+		case openai.RunStatusCancelled:
+			return Response{}, newRunError(res, ErrRunCancelled)
+		case openai.RunStatusIncomplete:
+			return Response{}, newRunError(res, ErrRunIncomplete)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Response{}, s.cancelRun(ctx, threadId, runId)
+		case <-timer.C:
+		}
+		delay = min(delay*2, s.config.OpenAI.PollMaxInterval)
+	}
+}
+
+// cancelRun cancels a run that did not finish in time and returns the error
+// reported for it.
+func (s *openaiService) cancelRun(ctx context.Context, threadId string, runId string) error {
+	s.logger.Error("assistant run timed out, cancelling", "run_id", runId, "timeout", s.config.OpenAI.Timeout)
+
+	// the run context is done by now
+	cancelCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if _, err := s.openai.CancelRun(cancelCtx, threadId, runId); err != nil {
+		s.logger.Error("failed to cancel run", "error", err, "run_id", runId)
+	}
+
+	return &RunError{RunId: runId, Status: openai.RunStatusCancelling, err: ErrRunTimeout}
+}
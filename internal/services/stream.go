@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/mngn84/avito-cons/internal/models/openai_models"
+)
+
+// errStreamUnavailable means the API answered without a stream, so the run
+// was not created and it is safe to fall back to polling. A request that
+// failed on the way, e.g. timed out, may have created the run and is not
+// reported as unavailable.
+var errStreamUnavailable = errors.New("run streaming unavailable")
+
+type streamRunRequest struct {
+	openai.RunRequest
+	Stream bool `json:"stream"`
+}
+
+type streamToolOutputsRequest struct {
+	openai.SubmitToolOutputsRequest
+	Stream bool `json:"stream"`
+}
+
+type streamEvent struct {
+	name string
+	data string
+}
+
+// streamResponse creates the run with server-sent events and assembles the
+// answer from message deltas. Tool calls are answered on the same stream,
+// the same deadline and terminal state errors apply as for polling. When the
+// stream breaks the run is polled within what is left of the deadline.
+func (s *openaiService) streamResponse(ctx context.Context, threadId string, request openai.RunRequest, toolCtx *ToolContext) (Response, error) {
+	body, err := s.openStream(ctx, fmt.Sprintf("/threads/%s/runs", threadId), streamRunRequest{RunRequest: request, Stream: true})
+	if err != nil {
+		return Response{}, err
+	}
+
+	response := toolCtx.Response
+	runId := ""
+	// text parts of the current message by content index
+	parts := map[int]*strings.Builder{}
+
+	for {
+		event, err := body.next()
+		if err != nil {
+			body.Close()
+			if runId == "" {
+				return Response{}, fmt.Errorf("failed to read run stream: %w", err)
+			}
+			if ctx.Err() != nil {
+				return Response{}, s.cancelRun(ctx, threadId, runId)
+			}
+			s.logger.Warn("run stream broken, polling the run", "error", err, "run_id", runId)
+			return s.waitForResponse(ctx, threadId, runId, toolCtx)
+		}
+
+		switch event.name {
+		case "thread.run.created":
+			run := openai.Run{}
+			if err := json.Unmarshal([]byte(event.data), &run); err == nil {
+				runId = run.ID
+				response.RunId = run.ID
+			}
+		case "thread.message.created":
+			parts = map[int]*strings.Builder{}
+		case "thread.message.delta":
+			delta := openai_models.MessageDeltaEvent{}
+			if err := json.Unmarshal([]byte(event.data), &delta); err != nil {
+				s.logger.Error("failed to decode message delta", "error", err)
+				continue
+			}
+			for _, content := range delta.Delta.Content {
+				if content.Text == nil {
+					continue
+				}
+				if parts[content.Index] == nil {
+					parts[content.Index] = &strings.Builder{}
+				}
+				parts[content.Index].WriteString(content.Text.Value)
+			}
+		case "thread.run.requires_action":
+			body.Close()
+			run := openai.Run{}
+			if err := json.Unmarshal([]byte(event.data), &run); err != nil {
+				return Response{}, fmt.Errorf("failed to decode run: %w", err)
+			}
+
+			outputs, err := s.callTools(ctx, run, toolCtx)
+			if err != nil {
+				return Response{}, err
+			}
+
+			path := fmt.Sprintf("/threads/%s/runs/%s/submit_tool_outputs", threadId, run.ID)
+			body, err = s.openStream(ctx, path, streamToolOutputsRequest{
+				SubmitToolOutputsRequest: openai.SubmitToolOutputsRequest{ToolOutputs: outputs},
+				Stream:                   true,
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					return Response{}, s.cancelRun(ctx, threadId, run.ID)
+				}
+				// the run exists, a refused stream must not start another one
+				return Response{}, fmt.Errorf("failed to submit tool outputs: %v", err)
+			}
+		case "thread.run.completed":
+			body.Close()
+			text := joinParts(parts)
+			if text == "" && response.Escalation == nil {
+				return Response{}, fmt.Errorf("no messages found")
+			}
+
+			run := openai.Run{}
+			if err := json.Unmarshal([]byte(event.data), &run); err == nil {
+				response.Usage.add(run.Usage)
+			}
+			response.Text = text
+			return *response, nil
+		case "thread.run.failed", "thread.run.expired", "thread.run.cancelled", "thread.run.incomplete":
+			body.Close()
+			run := openai.Run{}
+			if err := json.Unmarshal([]byte(event.data), &run); err != nil {
+				return Response{}, fmt.Errorf("failed to decode run: %w", err)
+			}
+			return Response{}, newRunError(run, runStatusError(run.Status))
+		case "error":
+			body.Close()
+			streamErr := openai_models.StreamError{}
+			_ = json.Unmarshal([]byte(event.data), &streamErr)
+			return Response{}, fmt.Errorf("run stream error: %s %s", streamErr.Code, streamErr.Message)
+		case "done":
+			body.Close()
+			if runId == "" {
+				return Response{}, fmt.Errorf("run stream ended without a terminal state")
+			}
+			s.logger.Warn("run stream ended early, polling the run", "run_id", runId)
+			return s.waitForResponse(ctx, threadId, runId, toolCtx)
+		}
+	}
+}
+
+func runStatusError(status openai.RunStatus) error {
+	switch status {
+	case openai.RunStatusExpired:
+		return ErrRunExpired
+	case openai.RunStatusCancelled:
+		return ErrRunCancelled
+	case openai.RunStatusIncomplete:
+		return ErrRunIncomplete
+	}
+	return ErrRunFailed
+}
+
+func joinParts(parts map[int]*strings.Builder) string {
+	indexes := []int{}
+	for index := range parts {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	text := strings.Builder{}
+	for _, index := range indexes {
+		text.WriteString(parts[index].String())
+	}
+	return text.String()
+}
+
+func (s *openaiService) openStream(ctx context.Context, path string, request any) (*eventStream, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json: %w", err)
+	}
+
+	req, err := s.newApiRequest(ctx, path, payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := s.stream.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run stream: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: unexpected status code %d: %s", errStreamUnavailable, res.StatusCode, body)
+	}
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream") {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: unexpected content type %q", errStreamUnavailable, res.Header.Get("Content-Type"))
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	return &eventStream{body: res.Body, scanner: scanner}, nil
+}
+
+type eventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// next returns the next server-sent event; comments and ids are skipped.
+func (e *eventStream) next() (streamEvent, error) {
+	event := streamEvent{}
+	data := []string{}
+
+	for e.scanner.Scan() {
+		line := e.scanner.Text()
+
+		if line == "" {
+			if event.name == "" && len(data) == 0 {
+				continue
+			}
+			event.data = strings.Join(data, "\n")
+			return event, nil
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.name = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+
+	if err := e.scanner.Err(); err != nil {
+		return streamEvent{}, err
+	}
+	return streamEvent{}, io.ErrUnexpectedEOF
+}
+
+func (e *eventStream) Close() error {
+	return e.body.Close()
+}
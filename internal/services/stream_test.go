@@ -0,0 +1,107 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+)
+
+func TestOpenStreamFallsBackOnlyWithoutRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		unavailable bool
+	}{
+		{
+			name: "error status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "stream is not supported", http.StatusBadRequest)
+			},
+			unavailable: true,
+		},
+		{
+			name: "json instead of events",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"id":"run_1"}`))
+			},
+			unavailable: true,
+		},
+		{
+			// the run may have been created before the request timed out
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// the server notices the gone client once the body is read
+				io.ReadAll(r.Body)
+				<-r.Context().Done()
+			},
+			unavailable: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			s := &openaiService{
+				config: &config.Config{OpenAI: config.OpenAIConfig{ApiUrl: server.URL}},
+				logger: testLogger(),
+				stream: &http.Client{},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			_, err := s.openStream(ctx, "/threads/t1/runs", streamRunRequest{Stream: true})
+			if err == nil {
+				t.Fatal("openStream succeeded")
+			}
+			if got := errors.Is(err, errStreamUnavailable); got != tt.unavailable {
+				t.Fatalf("unavailable = %t, want %t: %v", got, tt.unavailable, err)
+			}
+		})
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	r := strings.NewReader(": keep-alive\n\n" +
+		"event: thread.run.created\n" +
+		"id: 1\n" +
+		"data: {\"id\":\"run_1\"}\n\n" +
+		"event: thread.message.delta\n" +
+		"data: first\n" +
+		"data:second\n\n\n" +
+		"data: [DONE]\n\n" +
+		"event: thread.run.completed\n" +
+		"data: {}\n")
+	stream := &eventStream{body: io.NopCloser(r), scanner: bufio.NewScanner(r)}
+
+	want := []streamEvent{
+		{name: "thread.run.created", data: `{"id":"run_1"}`},
+		{name: "thread.message.delta", data: "first\nsecond"},
+		{data: "[DONE]"},
+	}
+	for i, w := range want {
+		event, err := stream.next()
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if event != w {
+			t.Fatalf("event %d = %+v, want %+v", i, event, w)
+		}
+	}
+
+	// the last event is not terminated by a blank line
+	if event, err := stream.next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("next = %+v, %v, want io.ErrUnexpectedEOF", event, err)
+	}
+}
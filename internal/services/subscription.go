@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/models/avito_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+var ErrNoWebhookUrl = errors.New("WEBHOOK_HOST is not a public http(s) url")
+
+type SubscriptionService interface {
+	Sync(ctx context.Context) error
+	Subscribe(ctx context.Context, userId int) (string, error)
+	Unsubscribe(ctx context.Context, userId int) error
+	List(ctx context.Context, userId int) ([]avito_models.Subscription, error)
+}
+
+type subscriptionService struct {
+	avito    AvitoService
+	profiles ProfileService
+	config   *config.Config
+	logger   *slog.Logger
+}
+
+func NewSubscriptionService(config *config.Config, logger *slog.Logger, avito AvitoService, profiles ProfileService) SubscriptionService {
+	return &subscriptionService{
+		avito:    avito,
+		profiles: profiles,
+		config:   config,
+		logger:   logger,
+	}
+}
+
+// Sync subscribes every registered account to our webhook and drops
+// subscriptions to other paths of our host, e.g. left after a secret change.
+// Accounts are processed independently, the errors are joined.
+func (s *subscriptionService) Sync(ctx context.Context) error {
+	if _, err := s.baseUrl(); err != nil {
+		return err
+	}
+
+	profiles, err := s.profiles.List(ctx)
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		s.logger.Info("no accounts registered, nothing to subscribe")
+		return nil
+	}
+
+	errs := []error{}
+	for i := range profiles {
+		if err := s.sync(ctx, &profiles[i]); err != nil {
+			s.logger.Error("failed to sync webhook subscription", "user_id", profiles[i].UserId, "error", err)
+			errs = append(errs, fmt.Errorf("user %d: %w", profiles[i].UserId, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *subscriptionService) sync(ctx context.Context, profile *storage.Profile) error {
+	webhookUrl, err := s.webhookUrl(profile)
+	if err != nil {
+		return err
+	}
+	base, _ := s.baseUrl()
+
+	subs, err := s.avito.ListSubscriptions(ctx, profile.UserId)
+	if err != nil {
+		return fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	subscribed := false
+	for _, sub := range subs {
+		if sub.Url == webhookUrl {
+			subscribed = true
+			continue
+		}
+		if isOwnWebhook(sub.Url, base) {
+			s.logger.Info("removing stale webhook subscription", "user_id", profile.UserId)
+			if err := s.avito.Unsubscribe(ctx, profile.UserId, sub.Url); err != nil {
+				return fmt.Errorf("failed to unsubscribe: %w", err)
+			}
+		}
+	}
+
+	if subscribed {
+		s.logger.Info("webhook already subscribed", "user_id", profile.UserId)
+		return nil
+	}
+
+	if err := s.avito.Subscribe(ctx, profile.UserId, webhookUrl); err != nil {
+		return fmt.Errorf("failed to subscribe: %w", err)
+	}
+	s.logger.Info("webhook subscribed", "user_id", profile.UserId)
+
+	return nil
+}
+
+func (s *subscriptionService) Subscribe(ctx context.Context, userId int) (string, error) {
+	profile, err := s.profiles.Get(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	webhookUrl, err := s.webhookUrl(profile)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.avito.Subscribe(ctx, userId, webhookUrl); err != nil {
+		return "", fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	return webhookUrl, nil
+}
+
+func (s *subscriptionService) Unsubscribe(ctx context.Context, userId int) error {
+	profile, err := s.profiles.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	webhookUrl, err := s.webhookUrl(profile)
+	if err != nil {
+		return err
+	}
+
+	if err := s.avito.Unsubscribe(ctx, userId, webhookUrl); err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+
+	return nil
+}
+
+func (s *subscriptionService) List(ctx context.Context, userId int) ([]avito_models.Subscription, error) {
+	if _, err := s.profiles.Get(ctx, userId); err != nil {
+		return nil, err
+	}
+
+	return s.avito.ListSubscriptions(ctx, userId)
+}
+
+// isOwnWebhook reports whether the url is one of our routes: /webhook itself
+// or /webhook/{secret} with any secret. Other urls sharing the prefix belong
+// to someone else.
+func isOwnWebhook(subUrl, base string) bool {
+	if subUrl == base {
+		return true
+	}
+	secret, ok := strings.CutPrefix(subUrl, base+"/")
+	return ok && secret != "" && !strings.ContainsAny(secret, "/?#")
+}
+
+// baseUrl is the public address of the /webhook route on WEBHOOK_HOST.
+func (s *subscriptionService) baseUrl() (string, error) {
+	u, err := url.Parse(s.config.Webhook.Host)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", ErrNoWebhookUrl
+	}
+
+	return strings.TrimSuffix(u.String(), "/") + "/webhook", nil
+}
+
+// webhookUrl puts the shared secret into the path for accounts using secret
+// authentication, since Avito cannot send custom headers.
+func (s *subscriptionService) webhookUrl(profile *storage.Profile) (string, error) {
+	base, err := s.baseUrl()
+	if err != nil {
+		return "", err
+	}
+
+	for _, method := range strings.Split(profile.WebhookAuth, ",") {
+		if strings.TrimSpace(method) == "secret" && profile.WebhookSecret != "" {
+			return base + "/" + url.PathEscape(profile.WebhookSecret), nil
+		}
+	}
+
+	return base, nil
+}
@@ -0,0 +1,27 @@
+package services
+
+import "testing"
+
+func TestIsOwnWebhook(t *testing.T) {
+	const base = "https://bot.example.com/webhook"
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://bot.example.com/webhook", true},
+		{"https://bot.example.com/webhook/s3cret", true},
+		{"https://bot.example.com/webhook/", false},
+		{"https://bot.example.com/webhooks", false},
+		{"https://bot.example.com/webhook/s3cret/other", false},
+		{"https://bot.example.com/webhook/s3cret?next=1", false},
+		{"https://bot.example.com/webhook/s3cret#x", false},
+		{"https://other.example.com/webhook", false},
+	}
+
+	for _, tt := range tests {
+		if got := isOwnWebhook(tt.url, base); got != tt.want {
+			t.Errorf("isOwnWebhook(%q) = %t, want %t", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	stdhttp "net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/http"
+	"github.com/mngn84/avito-cons/internal/models/avito_models"
+)
+
+type TokenProvider interface {
+	Token(ctx context.Context, userId int) (string, error)
+	Invalidate(userId int)
+}
+
+type cachedToken struct {
+	mu        sync.Mutex
+	value     string
+	expiresAt time.Time
+}
+
+type avitoTokenProvider struct {
+	client   *http.Client
+	config   *config.Config
+	logger   *slog.Logger
+	profiles ProfileService
+
+	mu     sync.Mutex
+	tokens map[int]*cachedToken
+}
+
+func NewAvitoTokenProvider(config *config.Config, logger *slog.Logger, profiles ProfileService) TokenProvider {
+	httpClient := &stdhttp.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	retryConfig := http.RetryConfig{
+		MaxRetries: 3,
+		BaseDelay:  1 * time.Second,
+		MaxDelay:   5 * time.Second,
+	}
+
+	return &avitoTokenProvider{
+		// no logger: the client logs response bodies, which hold the tokens
+		client:   http.NewClient(httpClient, nil, retryConfig),
+		config:   config,
+		logger:   logger,
+		profiles: profiles,
+		tokens:   map[int]*cachedToken{},
+	}
+}
+
+// Token returns a cached access token for the account, requesting a new one
+// when the cached token is missing or about to expire. Accounts without
+// client credentials fall back to the static AVITO_TOKEN.
+func (p *avitoTokenProvider) Token(ctx context.Context, userId int) (string, error) {
+	entry := p.entry(userId)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.value != "" && time.Now().Add(p.config.Avito.TokenRefreshMargin).Before(entry.expiresAt) {
+		return entry.value, nil
+	}
+
+	profile, err := p.profiles.Get(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	if profile.ClientId == "" {
+		if p.config.Avito.Token == "" {
+			return "", fmt.Errorf("no avito credentials for user %d", userId)
+		}
+		return p.config.Avito.Token, nil
+	}
+
+	res, err := p.requestToken(ctx, profile.ClientId, profile.ClientSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to get avito token: %w", err)
+	}
+
+	entry.value = res.AccessToken
+	entry.expiresAt = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	p.logger.Info("avito token refreshed", "user_id", userId, "expires_at", entry.expiresAt)
+
+	return entry.value, nil
+}
+
+func (p *avitoTokenProvider) Invalidate(userId int) {
+	entry := p.entry(userId)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	entry.value = ""
+	entry.expiresAt = time.Time{}
+}
+
+func (p *avitoTokenProvider) entry(userId int) *cachedToken {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.tokens[userId]
+	if !ok {
+		entry = &cachedToken{}
+		p.tokens[userId] = entry
+	}
+	return entry
+}
+
+func (p *avitoTokenProvider) requestToken(ctx context.Context, clientId, clientSecret string) (avito_models.TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", clientId)
+	form.Set("client_secret", clientSecret)
+
+	req, err := stdhttp.NewRequestWithContext(ctx, "POST", p.config.Avito.ApiUrl+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return avito_models.TokenResponse{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := p.client.Do(ctx, req)
+	if err != nil {
+		return avito_models.TokenResponse{}, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	res := avito_models.TokenResponse{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return avito_models.TokenResponse{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if res.AccessToken == "" {
+		return avito_models.TokenResponse{}, fmt.Errorf("empty access token in response")
+	}
+
+	return res, nil
+}
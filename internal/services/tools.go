@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/mngn84/avito-cons/internal/models/avito_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+// ToolContext describes the conversation a tool is called in. Tools report
+// side effects to the caller through Response.
+type ToolContext struct {
+	Profile  *storage.Profile
+	ChatId   string
+	Item     avito_models.Value
+	Response *Response
+}
+
+// ToolHandler receives the raw JSON arguments chosen by the model and returns
+// the output passed back to it.
+type ToolHandler func(ctx context.Context, toolCtx *ToolContext, args json.RawMessage) (any, error)
+
+type registeredTool struct {
+	definition openai.FunctionDefinition
+	handler    ToolHandler
+}
+
+type ToolRegistry struct {
+	logger *slog.Logger
+	tools  []registeredTool
+}
+
+func NewToolRegistry(logger *slog.Logger) *ToolRegistry {
+	return &ToolRegistry{logger: logger}
+}
+
+func (r *ToolRegistry) Register(definition openai.FunctionDefinition, handler ToolHandler) {
+	r.tools = append(r.tools, registeredTool{definition: definition, handler: handler})
+}
+
+func (r *ToolRegistry) Definitions() []openai.Tool {
+	tools := []openai.Tool{}
+	for i := range r.tools {
+		tools = append(tools, openai.Tool{
+			Type:     openai.ToolTypeFunction,
+			Function: &r.tools[i].definition,
+		})
+	}
+	return tools
+}
+
+// ToolDefinitions describes the tools for a Provider.
+func (r *ToolRegistry) ToolDefinitions() []ToolDefinition {
+	tools := []ToolDefinition{}
+	for _, tool := range r.tools {
+		tools = append(tools, ToolDefinition{
+			Name:        tool.definition.Name,
+			Description: tool.definition.Description,
+			Parameters:  tool.definition.Parameters,
+		})
+	}
+	return tools
+}
+
+// Call runs the tool and encodes its output as JSON. Errors are returned to
+// the model as {"error": ...} instead of failing the run, so it can answer
+// without the data.
+func (r *ToolRegistry) Call(ctx context.Context, toolCtx *ToolContext, name string, args string) string {
+	var output any
+	err := fmt.Errorf("unknown tool %s", name)
+
+	for _, tool := range r.tools {
+		if tool.definition.Name == name {
+			output, err = tool.handler(ctx, toolCtx, json.RawMessage(args))
+			break
+		}
+	}
+
+	if err != nil {
+		r.logger.Error("tool call failed", "tool", name, "arguments", args, "error", err)
+		output = map[string]string{"error": err.Error()}
+	}
+
+	data, err := json.Marshal(output)
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q}`, err.Error())
+	}
+	return string(data)
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/mngn84/avito-cons/internal/config"
+)
+
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, fileName string) (string, error)
+}
+
+type whisperTranscriber struct {
+	client *openai.Client
+	model  string
+}
+
+// NewWhisperTranscriber works with the OpenAI transcription endpoint and any
+// Whisper-compatible server behind OPENAI_URL.
+func NewWhisperTranscriber(config *config.Config, clientConfig openai.ClientConfig) Transcriber {
+	return &whisperTranscriber{
+		client: openai.NewClientWithConfig(clientConfig),
+		model:  config.OpenAI.TranscriptionModel,
+	}
+}
+
+func (t *whisperTranscriber) Transcribe(ctx context.Context, audio []byte, fileName string) (string, error) {
+	res, err := t.client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    t.model,
+		FilePath: fileName,
+		Reader:   bytes.NewReader(audio),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to transcribe audio: %w", err)
+	}
+
+	return strings.TrimSpace(res.Text), nil
+}
+
+type fakeTranscriber struct {
+	text string
+}
+
+// NewFakeTranscriber returns the same text for any audio.
+func NewFakeTranscriber(text string) Transcriber {
+	return &fakeTranscriber{text: text}
+}
+
+func (t *fakeTranscriber) Transcribe(ctx context.Context, audio []byte, fileName string) (string, error) {
+	return t.text, nil
+}
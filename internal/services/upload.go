@@ -40,5 +40,5 @@ func (s *UploadService) UploadFile(r *http.Request) (string, error) {
 	
 	s.logger.Info("UploadFile", "fileType", fileType, "profileName", profileName, "fileName", header.Filename)
 
-	return s.openai.UploadFileToVectorStore(file, header.Filename, profileName, fileType)
+	return s.openai.UploadFileToVectorStore(r.Context(), file, header.Filename, profileName, fileType)
 }
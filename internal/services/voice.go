@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+type VoiceService interface {
+	Transcript(ctx context.Context, msg *handlers_models.FromAvitoMsg) (string, error)
+}
+
+type voiceService struct {
+	avito       AvitoService
+	transcriber Transcriber
+	db          storage.TranscriptRepo
+	logger      *slog.Logger
+}
+
+func NewVoiceService(logger *slog.Logger, avito AvitoService, transcriber Transcriber, db storage.TranscriptRepo) VoiceService {
+	return &voiceService{
+		avito:       avito,
+		transcriber: transcriber,
+		db:          db,
+		logger:      logger,
+	}
+}
+
+// Transcript returns the text of a voice message. The transcript is stored
+// with the webhook event, so a retried job does not transcribe it again.
+func (s *voiceService) Transcript(ctx context.Context, msg *handlers_models.FromAvitoMsg) (string, error) {
+	if msg.Content.Voice == nil || msg.Content.Voice.VoiceId == "" {
+		return "", fmt.Errorf("message %s has no voice content", msg.Id)
+	}
+
+	if msg.Id != "" {
+		transcript, err := s.db.GetTranscript(ctx, msg.Id)
+		if err != nil {
+			s.logger.Error("failed to get transcript", "error", err, "msg_id", msg.Id)
+		}
+		if transcript != "" {
+			return transcript, nil
+		}
+	}
+
+	audio, err := s.avito.DownloadVoice(ctx, msg.UserId, msg.Content.Voice.VoiceId)
+	if err != nil {
+		return "", err
+	}
+
+	// Avito serves voice messages as mp4 audio
+	transcript, err := s.transcriber.Transcribe(ctx, audio, msg.Content.Voice.VoiceId+".mp4")
+	if err != nil {
+		return "", err
+	}
+	if transcript == "" {
+		return "", fmt.Errorf("empty transcript for voice %s", msg.Content.Voice.VoiceId)
+	}
+	s.logger.Info("voice message transcribed", "msg_id", msg.Id, "chat_id", msg.ChatId)
+
+	if msg.Id != "" {
+		if err := s.db.SaveTranscript(ctx, msg.Id, transcript); err != nil {
+			s.logger.Error("failed to save transcript", "error", err, "msg_id", msg.Id)
+		}
+	}
+
+	return transcript, nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mngn84/avito-cons/internal/models/handlers_models"
+	"github.com/mngn84/avito-cons/internal/storage/memory"
+)
+
+func voiceMessage(id string) *handlers_models.FromAvitoMsg {
+	return &handlers_models.FromAvitoMsg{
+		Id:      id,
+		ChatId:  "c1",
+		UserId:  1,
+		Type:    string(handlers_models.VoiceMsg),
+		Content: handlers_models.MsgContent{Voice: &handlers_models.VoiceContent{VoiceId: "v1"}},
+	}
+}
+
+func TestVoiceTranscriptIsStored(t *testing.T) {
+	db := memory.NewStore()
+	avito := &fakeAvito{}
+	voice := NewVoiceService(testLogger(), avito, NewFakeTranscriber("where to pick it up?"), db)
+	ctx := context.Background()
+
+	// the transcript is kept with the webhook event of the queued message
+	if _, err := db.EnqueueJob(ctx, "m1", 1, "c1", []byte(`{}`), 3); err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	text, err := voice.Transcript(ctx, voiceMessage("m1"))
+	if err != nil {
+		t.Fatalf("Transcript: %v", err)
+	}
+	if text != "where to pick it up?" {
+		t.Fatalf("Transcript = %q, want the fake transcript", text)
+	}
+
+	// a retried job reads the stored transcript
+	retry := NewVoiceService(testLogger(), avito, NewFakeTranscriber("something else"), db)
+	text, err = retry.Transcript(ctx, voiceMessage("m1"))
+	if err != nil {
+		t.Fatalf("Transcript: %v", err)
+	}
+	if text != "where to pick it up?" || avito.downloads != 1 {
+		t.Fatalf("retry = %q after %d downloads, want the stored transcript", text, avito.downloads)
+	}
+}
+
+func TestVoiceEmptyTranscript(t *testing.T) {
+	voice := NewVoiceService(testLogger(), &fakeAvito{}, NewFakeTranscriber(""), memory.NewStore())
+
+	if _, err := voice.Transcript(context.Background(), voiceMessage("m1")); err == nil {
+		t.Fatal("an empty transcript was accepted")
+	}
+}
+
+func TestVoiceWithoutContent(t *testing.T) {
+	avito := &fakeAvito{}
+	voice := NewVoiceService(testLogger(), avito, NewFakeTranscriber("text"), memory.NewStore())
+
+	msg := voiceMessage("m1")
+	msg.Content.Voice = nil
+	if _, err := voice.Transcript(context.Background(), msg); err == nil {
+		t.Fatal("a message without voice content was transcribed")
+	}
+	if avito.downloads != 0 {
+		t.Fatalf("%d downloads, want none", avito.downloads)
+	}
+}
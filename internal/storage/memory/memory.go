@@ -0,0 +1,520 @@
+// Package memory implements storage.Store in process. Nothing survives a
+// restart, it is meant for tests and trying the bot out locally.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+var _ storage.Store = (*Store)(nil)
+
+type thread struct {
+	threadId string
+	asstId   string
+}
+
+type assistant struct {
+	asstId   string
+	asstName string
+	userId   int
+}
+
+type vectorStore struct {
+	storeId   string
+	storeName string
+	asstId    string
+}
+
+type job struct {
+	storage.Job
+	status      string
+	runAt       time.Time
+	lockedBy    string
+	lockedUntil time.Time
+	lastError   string
+}
+
+type delivery struct {
+	storage.Delivery
+	createdAt time.Time
+}
+
+type chatKey struct {
+	userId int
+	chatId string
+}
+
+type event struct {
+	userId     int
+	chatId     string
+	state      string
+	transcript string
+}
+
+type Store struct {
+	mu sync.Mutex
+
+	profiles   map[int]storage.Profile
+	assistants []assistant
+	stores     []vectorStore
+	threads    map[string]thread
+	files      []storage.File
+	messages   []storage.Message
+	states     map[chatKey]storage.ChatState
+	deliveries []*delivery
+	jobs       []*job
+	events     map[string]*event
+
+	messageId  int64
+	jobId      int64
+	deliveryId int64
+}
+
+func NewStore() *Store {
+	return &Store{
+		profiles: map[int]storage.Profile{},
+		threads:  map[string]thread{},
+		states:   map[chatKey]storage.ChatState{},
+		events:   map[string]*event{},
+	}
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+// SaveProfile adds or replaces a profile, there is no admin API for them.
+func (s *Store) SaveProfile(p storage.Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.profiles[p.UserId] = p
+}
+
+func (s *Store) GetProfile(ctx context.Context, userId int) (*storage.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.profiles[userId]
+	if !ok {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (s *Store) ListProfiles(ctx context.Context) ([]storage.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := []storage.Profile{}
+	for _, p := range s.profiles {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].UserId < profiles[j].UserId })
+	return profiles, nil
+}
+
+func (s *Store) GetUserId(ctx context.Context, profileName string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.profiles {
+		if p.ProfileName == profileName {
+			return p.UserId, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *Store) GetAssistantId(ctx context.Context, userId int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.assistants {
+		if a.userId == userId {
+			return a.asstId, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *Store) SaveAssistant(ctx context.Context, asstId, asstName string, userId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.assistants {
+		if a.asstId == asstId {
+			return fmt.Errorf("assistant %s already exists", asstId)
+		}
+	}
+	s.assistants = append(s.assistants, assistant{asstId: asstId, asstName: asstName, userId: userId})
+	return nil
+}
+
+func (s *Store) GetStoreId(ctx context.Context, asstId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range s.stores {
+		if v.asstId == asstId {
+			return v.storeId, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *Store) SaveStoreRecord(ctx context.Context, storeId, storeName, asstId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range s.stores {
+		if v.storeId == storeId {
+			return fmt.Errorf("vector store %s already exists", storeId)
+		}
+	}
+	s.stores = append(s.stores, vectorStore{storeId: storeId, storeName: storeName, asstId: asstId})
+	return nil
+}
+
+func (s *Store) GetThreadId(ctx context.Context, chatId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.threads[chatId].threadId, nil
+}
+
+func (s *Store) SaveThreadId(ctx context.Context, chatId string, threadId, asstId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.threads[chatId]; ok {
+		return fmt.Errorf("thread for chat %s already exists", chatId)
+	}
+	s.threads[chatId] = thread{threadId: threadId, asstId: asstId}
+	return nil
+}
+
+func (s *Store) SaveFileRecord(ctx context.Context, file storage.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.files {
+		if f.FileId == file.FileId {
+			return fmt.Errorf("file %s already exists", file.FileId)
+		}
+	}
+	file.CreatedAt = time.Now()
+	file.UpdatedAt = file.CreatedAt
+	s.files = append(s.files, file)
+	return nil
+}
+
+func (s *Store) UpdateFileStatus(ctx context.Context, fileId, storeFileId, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.files {
+		if s.files[i].FileId != fileId {
+			continue
+		}
+		if storeFileId != "" {
+			s.files[i].StoreFileId = storeFileId
+		}
+		s.files[i].Status = status
+		s.files[i].UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *Store) GetFiles(ctx context.Context, storeId, fileName, fileType string) ([]storage.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := []storage.File{}
+	// appended in creation order
+	for i := len(s.files) - 1; i >= 0; i-- {
+		f := s.files[i]
+		if f.StoreId == storeId && f.Name == fileName && f.Type == fileType {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (s *Store) DeleteFileRecord(ctx context.Context, fileId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := s.files[:0]
+	for _, f := range s.files {
+		if f.FileId != fileId {
+			files = append(files, f)
+		}
+	}
+	s.files = files
+	return nil
+}
+
+func (s *Store) GetMessages(ctx context.Context, limit int, chatId string, msgId string) ([]storage.GptMsg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// messages are kept in the order they were stored
+	messages := []storage.GptMsg{}
+	for i := len(s.messages) - 1; i >= 0 && len(messages) < limit; i-- {
+		m := s.messages[i]
+		if m.ChatId != chatId || (m.Role == "user" && m.AvitoMsgId == msgId) || (m.Role != "user" && m.SentAt == 0) {
+			continue
+		}
+		messages = append(messages, storage.GptMsg{Role: m.Role, Content: m.Content})
+	}
+	return messages, nil
+}
+
+func (s *Store) SaveMessage(ctx context.Context, m storage.Message) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m.Role == "user" && m.AvitoMsgId != "" {
+		for _, saved := range s.messages {
+			if saved.Role == "user" && saved.AvitoMsgId == m.AvitoMsgId {
+				return saved.Id, nil
+			}
+		}
+	}
+
+	s.messageId++
+	m.Id = s.messageId
+	s.messages = append(s.messages, m)
+	return m.Id, nil
+}
+
+func (s *Store) GetChatState(ctx context.Context, userId int, chatId string) (*storage.ChatState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[chatKey{userId: userId, chatId: chatId}]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (s *Store) SetChatState(ctx context.Context, state storage.ChatState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[chatKey{userId: state.UserId, chatId: state.ChatId}] = state
+	return nil
+}
+
+func (s *Store) IsDelivered(ctx context.Context, chatId, avitoMsgId, content string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.deliveries {
+		if d.AvitoMsgId != "" && d.AvitoMsgId == avitoMsgId {
+			return true, nil
+		}
+		if d.ChatId == chatId && d.Status == storage.DeliveryPending && d.Content == content &&
+			time.Since(d.createdAt) < time.Hour {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) SaveDelivery(ctx context.Context, d storage.Delivery) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveryId++
+	d.Id = s.deliveryId
+	s.deliveries = append(s.deliveries, &delivery{Delivery: d, createdAt: time.Now()})
+	return d.Id, nil
+}
+
+func (s *Store) UpdateDelivery(ctx context.Context, id int64, status, avitoMsgId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.deliveries {
+		if d.Id == id {
+			d.Status = status
+			if avitoMsgId != "" {
+				d.AvitoMsgId = avitoMsgId
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) HasReply(ctx context.Context, sourceMsgId string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.deliveries {
+		if d.SourceMsgId == sourceMsgId && d.Status != storage.DeliveryFailed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) EnqueueJob(ctx context.Context, msgId string, userId int, chatId string, payload []byte, maxAttempts int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msgId != "" {
+		if _, ok := s.events[msgId]; ok {
+			return false, nil
+		}
+		s.events[msgId] = &event{userId: userId, chatId: chatId, state: storage.EventReceived}
+	}
+
+	s.jobId++
+	s.jobs = append(s.jobs, &job{
+		Job: storage.Job{
+			Id:          s.jobId,
+			ChatId:      chatId,
+			Payload:     payload,
+			MaxAttempts: maxAttempts,
+		},
+		status: storage.JobPending,
+		runAt:  time.Now(),
+	})
+	return true, nil
+}
+
+// LeaseJobs follows the Postgres queue: only the oldest unfinished job of a
+// chat is eligible and expired leases are picked up again.
+func (s *Store) LeaseJobs(ctx context.Context, workerId string, limit int, lease time.Duration) ([]storage.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	busy := map[string]bool{}
+	jobs := []storage.Job{}
+
+	// jobs are kept in id order
+	for _, j := range s.jobs {
+		if len(jobs) == limit {
+			break
+		}
+		if j.status != storage.JobPending && j.status != storage.JobProcessing {
+			continue
+		}
+		if busy[j.ChatId] {
+			continue
+		}
+		busy[j.ChatId] = true
+
+		ready := (j.status == storage.JobPending && !j.runAt.After(now)) ||
+			(j.status == storage.JobProcessing && j.lockedUntil.Before(now))
+		if !ready {
+			continue
+		}
+
+		j.status = storage.JobProcessing
+		j.lockedBy = workerId
+		j.lockedUntil = now.Add(lease)
+		j.Attempts++
+		jobs = append(jobs, j.Job)
+	}
+
+	return jobs, nil
+}
+
+func (s *Store) CompleteJob(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j := s.job(id); j != nil {
+		j.status = storage.JobDone
+		j.lockedBy = ""
+		j.lockedUntil = time.Time{}
+	}
+	return nil
+}
+
+func (s *Store) FailJob(ctx context.Context, id int64, lastErr string, delay time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j := s.job(id)
+	if j == nil {
+		return "", fmt.Errorf("job %d not found", id)
+	}
+
+	j.status = storage.JobPending
+	if j.Attempts >= j.MaxAttempts {
+		j.status = storage.JobDead
+	}
+	j.lastError = lastErr
+	j.runAt = time.Now().Add(delay)
+	j.lockedBy = ""
+	j.lockedUntil = time.Time{}
+	return j.status, nil
+}
+
+func (s *Store) DeadJob(ctx context.Context, id int64, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j := s.job(id); j != nil {
+		j.status = storage.JobDead
+		j.lastError = lastErr
+		j.lockedBy = ""
+		j.lockedUntil = time.Time{}
+	}
+	return nil
+}
+
+func (s *Store) job(id int64) *job {
+	for _, j := range s.jobs {
+		if j.Id == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func (s *Store) SetEventState(ctx context.Context, msgId, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.events[msgId]; ok {
+		e.state = state
+	}
+	return nil
+}
+
+func (s *Store) GetTranscript(ctx context.Context, msgId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.events[msgId]; ok {
+		return e.transcript, nil
+	}
+	return "", nil
+}
+
+func (s *Store) SaveTranscript(ctx context.Context, msgId, transcript string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.events[msgId]; ok {
+		e.transcript = transcript
+	}
+	return nil
+}
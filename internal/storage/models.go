@@ -0,0 +1,133 @@
+package storage
+
+import "time"
+
+type Profile struct {
+	UserId       int
+	ProfileName  string
+	ClientId     string
+	ClientSecret string
+	SystemPrompt string
+	Model        string
+	SendMode     string
+	// assistants or chat, see services.Backend*
+	Backend string
+	// openai, compatible or fake, see services.Provider*
+	Provider string
+	// base url of the compatible provider
+	CompatibleUrl string
+
+	// comma separated webhook authentication methods and their settings
+	WebhookAuth   string
+	WebhookSecret string
+	WebhookIPs    string
+}
+
+type Message struct {
+	Id         int64
+	ChatId     string
+	UserId     int
+	AvitoMsgId string
+	Content    string
+	Role       string
+	CreatedAt  int
+
+	// set for generated replies
+	ThreadId         string
+	RunId            string
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	// unix time the reply was delivered, 0 for replies that were not sent
+	SentAt int
+}
+
+type GptMsg struct {
+	Role    string
+	Content string
+}
+
+const (
+	ChatActive    = "active"
+	ChatPaused    = "paused"
+	ChatHandedOff = "handed_off"
+)
+
+type ChatState struct {
+	ChatId string
+	UserId int
+	State  string
+	// nil while paused means until resumed manually
+	PausedUntil *time.Time
+	Reason      string
+}
+
+const (
+	SendModeAuto  = "auto"
+	SendModeDraft = "draft"
+)
+
+// a delivery is stored as pending before the message is sent, so our own
+// message is recognised even when its webhook arrives before the send returns
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliveryDraft   = "draft"
+)
+
+type Delivery struct {
+	Id          int64
+	ChatId      string
+	UserId      int
+	SourceMsgId string
+	AvitoMsgId  string
+	Content     string
+	Mode        string
+	Status      string
+}
+
+const (
+	JobPending    = "pending"
+	JobProcessing = "processing"
+	JobDone       = "done"
+	JobDead       = "dead"
+)
+
+type Job struct {
+	Id          int64
+	ChatId      string
+	Payload     []byte
+	Attempts    int
+	MaxAttempts int
+}
+
+const (
+	EventReceived   = "received"
+	EventProcessing = "processing"
+	EventDone       = "done"
+	EventFailed     = "failed"
+)
+
+// Status of a registered file: uploaded until it is attached to the vector
+// store, then the status of the vector store file (in_progress, completed,
+// failed or cancelled).
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusCompleted = "completed"
+	FileStatusFailed    = "failed"
+)
+
+type File struct {
+	FileId      string
+	StoreFileId string
+	StoreId     string
+	Name        string
+	Type        string
+	// hex sha256 of the content
+	ContentHash string
+	Size        int64
+	Status      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
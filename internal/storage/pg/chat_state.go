@@ -0,0 +1,66 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+// GetChatState returns nil without an error when the bot state of the chat
+// was never changed.
+func (c *PgClient) GetChatState(ctx context.Context, userId int, chatId string) (*storage.ChatState, error) {
+	c.logger.Info("GetChatState", "userId", userId, "chatId", chatId)
+
+	query := `SELECT chat_id, user_id, state, paused_until, COALESCE(reason, '')
+    FROM chat_states WHERE user_id = $1 AND chat_id = $2`
+
+	s := storage.ChatState{}
+	pausedUntil := sql.NullTime{}
+	err := c.db.QueryRowContext(ctx, query, userId, chatId).Scan(&s.ChatId, &s.UserId, &s.State, &pausedUntil, &s.Reason)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pausedUntil.Valid {
+		s.PausedUntil = &pausedUntil.Time
+	}
+
+	return &s, nil
+}
+
+func (c *PgClient) SetChatState(ctx context.Context, s storage.ChatState) error {
+	c.logger.Info("SetChatState", "userId", s.UserId, "chatId", s.ChatId, "state", s.State, "reason", s.Reason)
+
+	query := `INSERT INTO chat_states (chat_id, user_id, state, paused_until, reason)
+    VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+    ON CONFLICT (user_id, chat_id) DO UPDATE
+    SET state = EXCLUDED.state,
+        paused_until = EXCLUDED.paused_until,
+        reason = EXCLUDED.reason,
+        updated_at = now()`
+
+	_, err := c.db.ExecContext(ctx, query, s.ChatId, s.UserId, s.State, s.PausedUntil, s.Reason)
+	if err != nil {
+		c.logger.Error("SetChatState", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// IsDelivered reports whether the Avito message was sent by us.
+func (c *PgClient) IsDelivered(ctx context.Context, chatId, avitoMsgId, content string) (bool, error) {
+	query := `SELECT EXISTS (
+        SELECT 1 FROM deliveries
+         WHERE avito_msg_id = NULLIF($2, '')
+            OR (chat_id = $1 AND status = 'pending' AND content = $3
+                AND created_at > now() - interval '1 hour')
+    )`
+
+	delivered := false
+	err := c.db.QueryRowContext(ctx, query, chatId, avitoMsgId, content).Scan(&delivered)
+	return delivered, err
+}
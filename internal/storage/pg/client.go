@@ -1,46 +1,86 @@
 package pg
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log/slog"
-	"unicode/utf8"
+	"time"
 
 	_ "github.com/lib/pq"
 
 	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/storage"
 )
 
+var _ storage.Store = (*PgClient)(nil)
+
 type PgClient struct {
 	db     *sql.DB
 	logger *slog.Logger
 }
 
+// NewPgClient opens the pool and waits for the database, retrying the ping
+// POSTGRES_CONNECT_RETRIES times so the bot can start together with it.
 func NewPgClient(cfg *config.Config, logger *slog.Logger) (*PgClient, error) {
 	db, err := sql.Open("postgres", cfg.DB.URL)
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DB.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.DB.ConnMaxIdleTime)
 
-	return &PgClient{
+	client := &PgClient{
 		db:     db,
 		logger: logger,
-	}, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = client.Ping(ctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if attempt > cfg.DB.ConnectRetries {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		logger.Warn("database is not ready, retrying", "attempt", attempt, "error", err)
+		time.Sleep(cfg.DB.ConnectRetryDelay)
+	}
+
+	return client, nil
 }
 
 func (c *PgClient) DB() *sql.DB {
 	return c.db
 }
 
-func (c *PgClient) GetMessages(limit int, chatId string) ([]GptMsg, error) {
+func (c *PgClient) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+func (c *PgClient) Close() error {
+	return c.db.Close()
+}
+
+// GetMessages returns the newest messages of the chat in the order they were
+// stored, newest first, leaving out the inbound message msgId and replies that
+// were not sent.
+func (c *PgClient) GetMessages(ctx context.Context, limit int, chatId string, msgId string) ([]storage.GptMsg, error) {
 	c.logger.Info("GetMessages", "chatId", chatId)
 
 	query := `SELECT content, role
     FROM messages
-     WHERE chat_id = $1
-     ORDER BY created_at DESC
+     WHERE chat_id = $1 AND NOT (role = 'user' AND avito_msg_id IS NOT DISTINCT FROM $3)
+       AND (role = 'user' OR sent_at IS NOT NULL)
+     ORDER BY id DESC
      LIMIT $2`
 
-	rows, err := c.db.Query(query, chatId, limit)
+	rows, err := c.db.QueryContext(ctx, query, chatId, limit, msgId)
 	if err != nil {
 		return nil, err
 	}
@@ -48,9 +88,9 @@ func (c *PgClient) GetMessages(limit int, chatId string) ([]GptMsg, error) {
 
 	c.logger.Info("GetMessages", "rows", rows)
 
-	messages := []GptMsg{}
+	messages := []storage.GptMsg{}
 	for rows.Next() {
-		var msg GptMsg
+		var msg storage.GptMsg
 		err := rows.Scan(
 			&msg.Content,
 			&msg.Role,
@@ -65,51 +105,11 @@ func (c *PgClient) GetMessages(limit int, chatId string) ([]GptMsg, error) {
 	return messages, nil
 }
 
-func (c *PgClient) SaveMsgPair(userMsg DbRow, gptMsg DbRow) error {
-	c.logger.Info("SaveMsgPair", "userMsg", userMsg, "gptMsg", gptMsg)
-	tx, err := c.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	query := `INSERT INTO messages (chat_id, user_id, content, role, created_at)
-    VALUES ($1, $2, $3, $4, TO_TIMESTAMP($5))`
-
-	_, err = tx.Exec(
-		query,
-		userMsg.ChatId,
-		userMsg.UserId,
-		userMsg.Content,
-		userMsg.Role,
-		userMsg.CreatedAt,
-	)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	_, err = tx.Exec(
-		query,
-		gptMsg.ChatId,
-		gptMsg.UserId,
-		gptMsg.Content,
-		gptMsg.Role,
-		gptMsg.CreatedAt,
-	)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	c.logger.Info("SaveMsgPair", "tx", tx)
-	return tx.Commit()
-}
-
-func (c *PgClient) GetAssistantId(userId int) (string, error) {
+func (c *PgClient) GetAssistantId(ctx context.Context, userId int) (string, error) {
 	c.logger.Info("GetAssistantId", "userId", userId)
 	query := `SELECT asst_id FROM assistants WHERE user_id = $1`
 
-	rows, err := c.db.Query(query, userId)
+	rows, err := c.db.QueryContext(ctx, query, userId)
 	if err != nil {
 		c.logger.Error("GetAssistantId rows", "err", err)
 		return "", err
@@ -128,12 +128,12 @@ func (c *PgClient) GetAssistantId(userId int) (string, error) {
 	return asstId, nil
 }
 
-func (c *PgClient) SaveAssistant(asstId, asstName string, userId int) error {
+func (c *PgClient) SaveAssistant(ctx context.Context, asstId, asstName string, userId int) error {
 	c.logger.Info("SaveAssistantId", "asstId", asstId, "asstName", asstName, "userId", userId)
 
 	query := `INSERT INTO assistants (asst_id, asst_name, user_id) VALUES ($1, $2, $3)`
 
-	result, err := c.db.Exec(query, asstId, asstName, userId)
+	result, err := c.db.ExecContext(ctx, query, asstId, asstName, userId)
 	if err != nil {
 		c.logger.Error("SaveAssistantId", "err", err)
 		return err
@@ -147,12 +147,12 @@ func (c *PgClient) SaveAssistant(asstId, asstName string, userId int) error {
 	return nil
 }
 
-func (c *PgClient) GetThreadId(chatId string) (string, error) {
+func (c *PgClient) GetThreadId(ctx context.Context, chatId string) (string, error) {
 	c.logger.Info("GetThreadId", "chatId", chatId)
 
 	query := `SELECT thread_id FROM threads WHERE chat_id = $1`
 
-	rows, err := c.db.Query(query, chatId)
+	rows, err := c.db.QueryContext(ctx, query, chatId)
 	if err != nil {
 		return "", err
 	}
@@ -168,33 +168,26 @@ func (c *PgClient) GetThreadId(chatId string) (string, error) {
 	return threadId, nil
 }
 
-func (c *PgClient) GetUserId(profileName string) (int, error) {
+func (c *PgClient) GetUserId(ctx context.Context, profileName string) (int, error) {
 	c.logger.Info("GetUserId", "profileName", profileName)
 
 	query := `SELECT user_id FROM profiles WHERE profile_name = $1`
 
-	rows, err := c.db.Query(query, profileName)
-	if err != nil {
-		return 0, err
-	}
-
 	userId := 0
-	if rows.Next() {
-		err := rows.Scan(&userId)
-		if err != nil {
-			return 0, err
-		}
+	err := c.db.QueryRowContext(ctx, query, profileName).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return 0, nil
 	}
 
-	return userId, nil
+	return userId, err
 }
 
-func (c *PgClient) SaveThreadId(chatId string, threadId, asstId string) error {
+func (c *PgClient) SaveThreadId(ctx context.Context, chatId string, threadId, asstId string) error {
 	c.logger.Info("SaveThreadId", "chatId", chatId, "threadId", threadId)
 
 	query := `INSERT INTO threads (chat_id, thread_id, asst_id) VALUES ($1, $2, $3)`
 
-	_, err := c.db.Exec(query, chatId, threadId, asstId)
+	_, err := c.db.ExecContext(ctx, query, chatId, threadId, asstId)
 	if err != nil {
 		return err
 	}
@@ -202,12 +195,12 @@ func (c *PgClient) SaveThreadId(chatId string, threadId, asstId string) error {
 	return nil
 }
 
-func (c *PgClient) GetStoreId(asstId string) (string, error) {
+func (c *PgClient) GetStoreId(ctx context.Context, asstId string) (string, error) {
 	c.logger.Info("GetStoreId", "asstId", asstId)
 
 	query := `SELECT store_id FROM v_stores WHERE asst_id = $1`
 
-	rows, err := c.db.Query(query, asstId)
+	rows, err := c.db.QueryContext(ctx, query, asstId)
 	if err != nil {
 		return "", err
 	}
@@ -225,12 +218,12 @@ func (c *PgClient) GetStoreId(asstId string) (string, error) {
 	return storeId, nil
 }
 
-func (c *PgClient) SaveStoreRecord(storeId, storeName, asstId string) error {
+func (c *PgClient) SaveStoreRecord(ctx context.Context, storeId, storeName, asstId string) error {
 	c.logger.Info("SaveStoreRecord", "storeId", storeId, "storeName", storeName, "asstId", asstId)
 	
 	query := `INSERT INTO v_stores (store_id, store_name, asst_id) VALUES ($1, $2, $3)`
 	
-	result, err := c.db.Exec(query, storeId, storeName, asstId)
+	result, err := c.db.ExecContext(ctx, query, storeId, storeName, asstId)
 	if err != nil {
 		c.logger.Error("SaveStoreId", "err", err)
 		return err
@@ -245,64 +238,3 @@ func (c *PgClient) SaveStoreRecord(storeId, storeName, asstId string) error {
 
 	return nil
 }
-
-func (c *PgClient) SaveFileRecord(fileId, fileName, fileType, storeId string) error {
-	c.logger.Info("SaveFileRecord", "storeId", storeId, "fileId", fileId, "fileName", fileName, "fileType", fileType)
-
-	if !utf8.ValidString(fileName) {
-		c.logger.Info("SaveFileRecord", "fileName", fileName, "err", "invalid utf8 string")
-		fileName = string([]rune(fileName))
-	}
-
-	query := `INSERT INTO files (file_id, file_name, file_type, store_id) VALUES ($1, $2, $3, $4)`
-
-	result, err := c.db.Exec(query, fileId, fileName, fileType, storeId)
-	if err != nil {
-		c.logger.Error("SaveFileRecord", "err", err)
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		c.logger.Error("SaveFileRecord", "err", err)
-		return err
-	}
-	c.logger.Info("SaveFileRecord", "rowsAffected", rowsAffected)
-
-	return nil
-}
-
-func (c *PgClient) GetOldFileId(storeId, fileName, fileType string) (string, error) {
-	c.logger.Info("GetOldFile", "storeId", storeId, "fileName", fileName, "fileType", fileType)
-
-	query := `SELECT file_id FROM v_files WHERE store_id = $1 AND file_name = $2 AND file_type = $3`
-
-	rows, err := c.db.Query(query, storeId, fileName, fileType)
-	if err != nil {
-		return "", err
-	}
-	defer rows.Close()
-
-	oldFileId := ""
-	if rows.Next() {
-		err := rows.Scan(&oldFileId)
-		if err != nil {
-			return "", err
-		}
-	}
-	c.logger.Info("GetOldFile", "oldFileId", oldFileId)
-	return oldFileId, nil
-}
-
-func (c *PgClient) DeleteOldFile(storeId, fileId string) error {
-	c.logger.Info("DeleteOldFile", "storeId", storeId, "fileId", fileId)
-
-	query := `DELETE FROM v_files WHERE store_id = $1 AND file_id = $2`
-
-	_, err := c.db.Exec(query, storeId, fileId)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
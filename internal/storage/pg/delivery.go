@@ -0,0 +1,45 @@
+package pg
+
+import (
+	"context"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+func (c *PgClient) SaveDelivery(ctx context.Context, d storage.Delivery) (int64, error) {
+	c.logger.Info("SaveDelivery", "chatId", d.ChatId, "avitoMsgId", d.AvitoMsgId, "mode", d.Mode, "status", d.Status)
+
+	query := `INSERT INTO deliveries (chat_id, user_id, source_msg_id, avito_msg_id, content, mode, status)
+    VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+    RETURNING id`
+
+	id := int64(0)
+	err := c.db.QueryRowContext(ctx, query, d.ChatId, d.UserId, d.SourceMsgId, d.AvitoMsgId, d.Content, d.Mode, d.Status).Scan(&id)
+	if err != nil {
+		c.logger.Error("SaveDelivery", "err", err)
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (c *PgClient) UpdateDelivery(ctx context.Context, id int64, status, avitoMsgId string) error {
+	c.logger.Info("UpdateDelivery", "id", id, "status", status, "avitoMsgId", avitoMsgId)
+
+	query := `UPDATE deliveries SET status = $2, avito_msg_id = COALESCE(NULLIF($3, ''), avito_msg_id) WHERE id = $1`
+
+	_, err := c.db.ExecContext(ctx, query, id, status, avitoMsgId)
+	return err
+}
+
+// HasReply reports whether a reply to the Avito message was sent, saved as a
+// draft or may have been sent.
+func (c *PgClient) HasReply(ctx context.Context, sourceMsgId string) (bool, error) {
+	query := `SELECT EXISTS (
+        SELECT 1 FROM deliveries WHERE source_msg_id = $1 AND status <> 'failed'
+    )`
+
+	replied := false
+	err := c.db.QueryRowContext(ctx, query, sourceMsgId).Scan(&replied)
+	return replied, err
+}
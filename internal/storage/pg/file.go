@@ -0,0 +1,88 @@
+package pg
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+func (c *PgClient) SaveFileRecord(ctx context.Context, file storage.File) error {
+	c.logger.Info("SaveFileRecord", "storeId", file.StoreId, "fileId", file.FileId, "fileName", file.Name, "fileType", file.Type)
+
+	if !utf8.ValidString(file.Name) {
+		c.logger.Info("SaveFileRecord", "fileName", file.Name, "err", "invalid utf8 string")
+		file.Name = string([]rune(file.Name))
+	}
+
+	query := `INSERT INTO files (file_id, store_file_id, store_id, file_name, file_type, content_hash, size_bytes, status)
+    VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8)`
+
+	_, err := c.db.ExecContext(ctx, query, file.FileId, file.StoreFileId, file.StoreId, file.Name, file.Type, file.ContentHash, file.Size, file.Status)
+	if err != nil {
+		c.logger.Error("SaveFileRecord", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *PgClient) UpdateFileStatus(ctx context.Context, fileId, storeFileId, status string) error {
+	c.logger.Info("UpdateFileStatus", "fileId", fileId, "storeFileId", storeFileId, "status", status)
+
+	query := `UPDATE files
+    SET store_file_id = COALESCE(NULLIF($2, ''), store_file_id), status = $3, updated_at = now()
+    WHERE file_id = $1`
+
+	_, err := c.db.ExecContext(ctx, query, fileId, storeFileId, status)
+	return err
+}
+
+// GetFiles returns every record of the file name in the store, newest first.
+func (c *PgClient) GetFiles(ctx context.Context, storeId, fileName, fileType string) ([]storage.File, error) {
+	c.logger.Info("GetFiles", "storeId", storeId, "fileName", fileName, "fileType", fileType)
+
+	query := `SELECT file_id, COALESCE(store_file_id, ''), store_id, file_name, file_type,
+    COALESCE(content_hash, ''), COALESCE(size_bytes, 0), status, created_at, updated_at
+    FROM files
+     WHERE store_id = $1 AND file_name = $2 AND file_type = $3
+     ORDER BY created_at DESC`
+
+	rows, err := c.db.QueryContext(ctx, query, storeId, fileName, fileType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []storage.File{}
+	for rows.Next() {
+		var f storage.File
+		err := rows.Scan(
+			&f.FileId,
+			&f.StoreFileId,
+			&f.StoreId,
+			&f.Name,
+			&f.Type,
+			&f.ContentHash,
+			&f.Size,
+			&f.Status,
+			&f.CreatedAt,
+			&f.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	return files, rows.Err()
+}
+
+func (c *PgClient) DeleteFileRecord(ctx context.Context, fileId string) error {
+	c.logger.Info("DeleteFileRecord", "fileId", fileId)
+
+	query := `DELETE FROM files WHERE file_id = $1`
+
+	_, err := c.db.ExecContext(ctx, query, fileId)
+	return err
+}
@@ -1,23 +1,52 @@
 package pg
 
-type Message struct {
-    Id        int64
-    ChatId    string
-    UserId    int
-    Content   string
-    Role      string
-    CreatedAt int
-}
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+// SaveMessage stores a message and returns its id. An inbound message that
+// is already stored under the same Avito id is kept and its id returned.
+func (c *PgClient) SaveMessage(ctx context.Context, m storage.Message) (int64, error) {
+	c.logger.Info("SaveMessage", "chatId", m.ChatId, "avitoMsgId", m.AvitoMsgId, "role", m.Role)
 
-type GptMsg  struct {
-    Role    string
-    Content string
+	query := `INSERT INTO messages (chat_id, user_id, avito_msg_id, content, role, created_at,
+        thread_id, run_id, prompt_tokens, completion_tokens, total_tokens, sent_at)
+    VALUES ($1, $2, NULLIF($3, ''), $4, $5, TO_TIMESTAMP($6),
+        NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11, TO_TIMESTAMP($12))
+    ON CONFLICT (avito_msg_id) WHERE role = 'user' DO NOTHING
+    RETURNING id`
+
+	var id int64
+	err := c.db.QueryRowContext(
+		ctx,
+		query,
+		m.ChatId,
+		m.UserId,
+		m.AvitoMsgId,
+		m.Content,
+		m.Role,
+		m.CreatedAt,
+		m.ThreadId,
+		m.RunId,
+		nullInt(m.PromptTokens),
+		nullInt(m.CompletionTokens),
+		nullInt(m.TotalTokens),
+		nullInt(m.SentAt),
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = c.db.QueryRowContext(ctx, `SELECT id FROM messages WHERE avito_msg_id = $1 AND role = 'user'`, m.AvitoMsgId).Scan(&id)
+	}
+	if err != nil {
+		c.logger.Error("SaveMessage", "err", err)
+		return 0, err
+	}
+
+	return id, nil
 }
 
-type DbRow struct {
-    UserId    int
-    ChatId    string
-    Content   string
-    Role      string
-    CreatedAt int
-}
\ No newline at end of file
+func nullInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
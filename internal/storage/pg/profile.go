@@ -0,0 +1,80 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+const profileColumns = `user_id, profile_name, COALESCE(client_id, ''), COALESCE(client_secret, ''),
+    COALESCE(system_prompt, ''), COALESCE(model, ''), send_mode,
+    COALESCE(webhook_auth, ''), COALESCE(webhook_secret, ''), COALESCE(webhook_ips, ''),
+    COALESCE(backend, ''), COALESCE(provider, ''), COALESCE(compatible_url, '')`
+
+func scanProfile(rows *sql.Rows) (storage.Profile, error) {
+	var p storage.Profile
+	err := rows.Scan(
+		&p.UserId,
+		&p.ProfileName,
+		&p.ClientId,
+		&p.ClientSecret,
+		&p.SystemPrompt,
+		&p.Model,
+		&p.SendMode,
+		&p.WebhookAuth,
+		&p.WebhookSecret,
+		&p.WebhookIPs,
+		&p.Backend,
+		&p.Provider,
+		&p.CompatibleUrl,
+	)
+	return p, err
+}
+
+// GetProfile returns nil without an error when the account is not registered.
+func (c *PgClient) GetProfile(ctx context.Context, userId int) (*storage.Profile, error) {
+	c.logger.Info("GetProfile", "userId", userId)
+
+	query := `SELECT ` + profileColumns + ` FROM profiles WHERE user_id = $1`
+
+	rows, err := c.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	p, err := scanProfile(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (c *PgClient) ListProfiles(ctx context.Context) ([]storage.Profile, error) {
+	c.logger.Info("ListProfiles")
+
+	query := `SELECT ` + profileColumns + ` FROM profiles ORDER BY user_id`
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []storage.Profile{}
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+
+	return profiles, rows.Err()
+}
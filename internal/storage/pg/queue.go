@@ -0,0 +1,158 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+// EnqueueJob records the Avito message id and queues the payload in one
+// transaction. It returns false without queueing anything when the message id
+// was already received; messages without an id are never deduplicated.
+func (c *PgClient) EnqueueJob(ctx context.Context, msgId string, userId int, chatId string, payload []byte, maxAttempts int) (bool, error) {
+	c.logger.Info("EnqueueJob", "msgId", msgId, "chatId", chatId)
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if msgId != "" {
+		query := `INSERT INTO webhook_events (msg_id, user_id, chat_id) VALUES ($1, $2, $3)
+        ON CONFLICT (msg_id) DO NOTHING`
+
+		result, err := tx.ExecContext(ctx, query, msgId, userId, chatId)
+		if err != nil {
+			c.logger.Error("EnqueueJob", "err", err)
+			return false, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if rowsAffected == 0 {
+			return false, nil
+		}
+	}
+
+	query := `INSERT INTO message_queue (chat_id, payload, max_attempts) VALUES ($1, $2, $3)`
+
+	if _, err := tx.ExecContext(ctx, query, chatId, payload, maxAttempts); err != nil {
+		c.logger.Error("EnqueueJob", "err", err)
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// LeaseJobs locks up to limit ready jobs for workerId until the lease expires.
+// Only the oldest unfinished job of each chat is eligible, so messages of one
+// chat are processed in order and never concurrently. Jobs whose lease has
+// expired (worker crashed or was restarted) are picked up again.
+func (c *PgClient) LeaseJobs(ctx context.Context, workerId string, limit int, lease time.Duration) ([]storage.Job, error) {
+	query := `WITH next AS (
+        SELECT m.id
+        FROM message_queue m
+        WHERE ((m.status = 'pending' AND m.run_at <= now())
+            OR (m.status = 'processing' AND m.locked_until < now()))
+          AND NOT EXISTS (
+            SELECT 1 FROM message_queue p
+            WHERE p.chat_id = m.chat_id
+              AND p.id < m.id
+              AND p.status IN ('pending', 'processing'))
+        ORDER BY m.id
+        LIMIT $2
+        FOR UPDATE SKIP LOCKED
+    )
+    UPDATE message_queue q
+    SET status = 'processing',
+        locked_by = $1,
+        locked_until = now() + make_interval(secs => $3),
+        attempts = q.attempts + 1,
+        updated_at = now()
+    FROM next
+    WHERE q.id = next.id
+    RETURNING q.id, q.chat_id, q.payload, q.attempts, q.max_attempts`
+
+	rows, err := c.db.QueryContext(ctx, query, workerId, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []storage.Job{}
+	for rows.Next() {
+		var job storage.Job
+		err := rows.Scan(
+			&job.Id,
+			&job.ChatId,
+			&job.Payload,
+			&job.Attempts,
+			&job.MaxAttempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func (c *PgClient) CompleteJob(ctx context.Context, id int64) error {
+	c.logger.Info("CompleteJob", "id", id)
+
+	query := `UPDATE message_queue
+    SET status = 'done', locked_by = NULL, locked_until = NULL, updated_at = now()
+    WHERE id = $1`
+
+	_, err := c.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// FailJob releases the job for another attempt after delay, or moves it to
+// the dead letter state once max_attempts is reached.
+func (c *PgClient) FailJob(ctx context.Context, id int64, lastErr string, delay time.Duration) (string, error) {
+	c.logger.Info("FailJob", "id", id, "err", lastErr)
+
+	query := `UPDATE message_queue
+    SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+        last_error = $2,
+        run_at = now() + make_interval(secs => $3),
+        locked_by = NULL,
+        locked_until = NULL,
+        updated_at = now()
+    WHERE id = $1
+    RETURNING status`
+
+	status := ""
+	if err := c.db.QueryRowContext(ctx, query, id, lastErr, delay.Seconds()).Scan(&status); err != nil {
+		c.logger.Error("FailJob", "err", err)
+		return "", err
+	}
+
+	return status, nil
+}
+
+func (c *PgClient) DeadJob(ctx context.Context, id int64, lastErr string) error {
+	c.logger.Info("DeadJob", "id", id, "err", lastErr)
+
+	query := `UPDATE message_queue
+    SET status = 'dead', last_error = $2, locked_by = NULL, locked_until = NULL, updated_at = now()
+    WHERE id = $1`
+
+	_, err := c.db.ExecContext(ctx, query, id, lastErr)
+	return err
+}
+
+func (c *PgClient) SetEventState(ctx context.Context, msgId, state string) error {
+	c.logger.Info("SetEventState", "msgId", msgId, "state", state)
+
+	query := `UPDATE webhook_events SET state = $2, updated_at = now() WHERE msg_id = $1`
+
+	_, err := c.db.ExecContext(ctx, query, msgId, state)
+	return err
+}
@@ -0,0 +1,34 @@
+package pg
+
+import "context"
+
+// GetTranscript returns an empty string when the message was not transcribed.
+func (c *PgClient) GetTranscript(ctx context.Context, msgId string) (string, error) {
+	c.logger.Info("GetTranscript", "msgId", msgId)
+
+	query := `SELECT COALESCE(transcript, '') FROM webhook_events WHERE msg_id = $1`
+
+	rows, err := c.db.QueryContext(ctx, query, msgId)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	transcript := ""
+	if rows.Next() {
+		if err := rows.Scan(&transcript); err != nil {
+			return "", err
+		}
+	}
+
+	return transcript, rows.Err()
+}
+
+func (c *PgClient) SaveTranscript(ctx context.Context, msgId, transcript string) error {
+	c.logger.Info("SaveTranscript", "msgId", msgId)
+
+	query := `UPDATE webhook_events SET transcript = $2, updated_at = now() WHERE msg_id = $1`
+
+	_, err := c.db.ExecContext(ctx, query, msgId, transcript)
+	return err
+}
@@ -0,0 +1,172 @@
+// Package schema applies the SQL migrations of the configured database.
+package schema
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/golang-migrate/migrate"
+	_ "github.com/golang-migrate/migrate/database/postgres"
+	"github.com/golang-migrate/migrate/database/sqlite3"
+	"github.com/golang-migrate/migrate/source"
+	_ "github.com/golang-migrate/migrate/source/file"
+
+	"github.com/mngn84/avito-cons/internal/config"
+)
+
+// Migrator applies the SQL files from POSTGRES_MIGRATIONS, SQLite has its own
+// set in the sqlite subdirectory. Postgres is migrated on its own connection
+// because closing a migrate instance closes the database. SQLite goes through
+// the connection of the store, a :memory: database exists only there.
+type Migrator struct {
+	migrate *migrate.Migrate
+	source  string
+	logger  *slog.Logger
+	// set when the database belongs to the store and must stay open
+	sourceDriver source.Driver
+}
+
+type MigrationStatus struct {
+	// 0 when nothing was applied yet
+	Version uint
+	Dirty   bool
+	Latest  uint
+}
+
+// NewMigrator prepares the migrations of the configured database. db is the
+// connection of the store, it is only used for SQLite.
+func NewMigrator(cfg *config.Config, logger *slog.Logger, db *sql.DB) (*Migrator, error) {
+	if cfg.DB.Driver() == config.DriverSqlite {
+		return newSqliteMigrator(cfg, logger, db)
+	}
+
+	m, err := migrate.New(cfg.DB.MigrationsPath, cfg.DB.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init migrations: %w", err)
+	}
+
+	return &Migrator{
+		migrate: m,
+		source:  cfg.DB.MigrationsPath,
+		logger:  logger,
+	}, nil
+}
+
+func newSqliteMigrator(cfg *config.Config, logger *slog.Logger, db *sql.DB) (*Migrator, error) {
+	sourceUrl := strings.TrimSuffix(cfg.DB.MigrationsPath, "/") + "/sqlite"
+
+	sourceDriver, err := source.Open(sourceUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migrations: %w", err)
+	}
+
+	dbDriver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	if err != nil {
+		sourceDriver.Close()
+		return nil, fmt.Errorf("failed to init migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("file", sourceDriver, "sqlite3", dbDriver)
+	if err != nil {
+		sourceDriver.Close()
+		return nil, fmt.Errorf("failed to init migrations: %w", err)
+	}
+
+	return &Migrator{
+		migrate:      m,
+		source:       sourceUrl,
+		logger:       logger,
+		sourceDriver: sourceDriver,
+	}, nil
+}
+
+func (m *Migrator) Up() error {
+	err := m.migrate.Up()
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	version, _, _ := m.migrate.Version()
+	m.logger.Info("migrations applied", "version", version, "changed", err == nil)
+	return nil
+}
+
+// Down rolls back the given number of applied migrations.
+func (m *Migrator) Down(steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("steps must be positive")
+	}
+
+	err := m.migrate.Steps(-steps)
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to roll back migrations: %w", err)
+	}
+
+	version, _, _ := m.migrate.Version()
+	m.logger.Info("migrations rolled back", "version", version)
+	return nil
+}
+
+func (m *Migrator) Status() (MigrationStatus, error) {
+	status := MigrationStatus{}
+
+	version, dirty, err := m.migrate.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return status, fmt.Errorf("failed to get migration version: %w", err)
+	}
+	status.Version = version
+	status.Dirty = dirty
+
+	latest, err := latestMigration(m.source)
+	if err != nil {
+		return status, err
+	}
+	status.Latest = latest
+
+	return status, nil
+}
+
+func (m *Migrator) Close() {
+	if m.sourceDriver != nil {
+		// the database is closed with the store
+		if err := m.sourceDriver.Close(); err != nil {
+			m.logger.Error("failed to close migrations", "source", err)
+		}
+		return
+	}
+
+	sourceErr, dbErr := m.migrate.Close()
+	if sourceErr != nil || dbErr != nil {
+		m.logger.Error("failed to close migrations", "source", sourceErr, "db", dbErr)
+	}
+}
+
+func latestMigration(sourceUrl string) (uint, error) {
+	driver, err := source.Open(sourceUrl)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open migrations: %w", err)
+	}
+	defer driver.Close()
+
+	version, err := driver.First()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	for {
+		next, err := driver.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migrations: %w", err)
+		}
+		version = next
+	}
+}
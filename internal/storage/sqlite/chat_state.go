@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+// GetChatState returns nil without an error when the bot state of the chat
+// was never changed.
+func (c *SqliteClient) GetChatState(ctx context.Context, userId int, chatId string) (*storage.ChatState, error) {
+	c.logger.Info("GetChatState", "userId", userId, "chatId", chatId)
+
+	query := `SELECT chat_id, user_id, state, paused_until, COALESCE(reason, '')
+    FROM chat_states WHERE user_id = ? AND chat_id = ?`
+
+	s := storage.ChatState{}
+	pausedUntil := sql.NullInt64{}
+	err := c.db.QueryRowContext(ctx, query, userId, chatId).Scan(&s.ChatId, &s.UserId, &s.State, &pausedUntil, &s.Reason)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pausedUntil.Valid {
+		t := time.Unix(pausedUntil.Int64, 0)
+		s.PausedUntil = &t
+	}
+
+	return &s, nil
+}
+
+func (c *SqliteClient) SetChatState(ctx context.Context, s storage.ChatState) error {
+	c.logger.Info("SetChatState", "userId", s.UserId, "chatId", s.ChatId, "state", s.State, "reason", s.Reason)
+
+	pausedUntil := sql.NullInt64{}
+	if s.PausedUntil != nil {
+		pausedUntil = sql.NullInt64{Int64: s.PausedUntil.Unix(), Valid: true}
+	}
+
+	query := `INSERT INTO chat_states (chat_id, user_id, state, paused_until, reason)
+    VALUES (?, ?, ?, ?, ?)
+    ON CONFLICT (user_id, chat_id) DO UPDATE
+    SET state = excluded.state,
+        paused_until = excluded.paused_until,
+        reason = excluded.reason,
+        updated_at = unixepoch()`
+
+	_, err := c.db.ExecContext(ctx, query, s.ChatId, s.UserId, s.State, pausedUntil, nullString(s.Reason))
+	if err != nil {
+		c.logger.Error("SetChatState", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// IsDelivered reports whether the Avito message was sent by us.
+func (c *SqliteClient) IsDelivered(ctx context.Context, chatId, avitoMsgId, content string) (bool, error) {
+	query := `SELECT EXISTS (
+        SELECT 1 FROM deliveries
+         WHERE avito_msg_id = ?
+            OR (chat_id = ? AND status = 'pending' AND content = ?
+                AND created_at > unixepoch() - 3600)
+    )`
+
+	delivered := false
+	err := c.db.QueryRowContext(ctx, query, nullString(avitoMsgId), chatId, content).Scan(&delivered)
+	return delivered, err
+}
@@ -0,0 +1,182 @@
+// Package sqlite implements storage.Store on a single SQLite file for
+// deployments that run one instance of the bot. Timestamps are stored as unix
+// seconds.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+var _ storage.Store = (*SqliteClient)(nil)
+
+type SqliteClient struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func NewSqliteClient(cfg *config.Config, logger *slog.Logger) (*SqliteClient, error) {
+	dsn := cfg.DB.SqlitePath()
+	if !strings.Contains(dsn, "_busy_timeout") {
+		if strings.Contains(dsn, "?") {
+			dsn += "&_busy_timeout=5000"
+		} else {
+			dsn += "?_busy_timeout=5000"
+		}
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer; one connection also keeps :memory:
+	// databases alive and makes the queue leases safe
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	return &SqliteClient{
+		db:     db,
+		logger: logger,
+	}, nil
+}
+
+func (c *SqliteClient) DB() *sql.DB {
+	return c.db
+}
+
+func (c *SqliteClient) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
+func (c *SqliteClient) Close() error {
+	return c.db.Close()
+}
+
+// GetMessages returns the newest messages of the chat in the order they were
+// stored, newest first, leaving out the inbound message msgId and replies that
+// were not sent.
+func (c *SqliteClient) GetMessages(ctx context.Context, limit int, chatId string, msgId string) ([]storage.GptMsg, error) {
+	c.logger.Info("GetMessages", "chatId", chatId)
+
+	query := `SELECT content, role
+    FROM messages
+     WHERE chat_id = ? AND NOT (role = 'user' AND avito_msg_id IS ?)
+       AND (role = 'user' OR sent_at IS NOT NULL)
+     ORDER BY id DESC
+     LIMIT ?`
+
+	rows, err := c.db.QueryContext(ctx, query, chatId, msgId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []storage.GptMsg{}
+	for rows.Next() {
+		var msg storage.GptMsg
+		if err := rows.Scan(&msg.Content, &msg.Role); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+func (c *SqliteClient) GetAssistantId(ctx context.Context, userId int) (string, error) {
+	c.logger.Info("GetAssistantId", "userId", userId)
+
+	query := `SELECT asst_id FROM assistants WHERE user_id = ? LIMIT 1`
+
+	return c.queryString(ctx, query, userId)
+}
+
+func (c *SqliteClient) SaveAssistant(ctx context.Context, asstId, asstName string, userId int) error {
+	c.logger.Info("SaveAssistant", "asstId", asstId, "asstName", asstName, "userId", userId)
+
+	query := `INSERT INTO assistants (asst_id, asst_name, user_id) VALUES (?, ?, ?)`
+
+	_, err := c.db.ExecContext(ctx, query, asstId, asstName, userId)
+	return err
+}
+
+func (c *SqliteClient) GetThreadId(ctx context.Context, chatId string) (string, error) {
+	c.logger.Info("GetThreadId", "chatId", chatId)
+
+	query := `SELECT thread_id FROM threads WHERE chat_id = ?`
+
+	return c.queryString(ctx, query, chatId)
+}
+
+func (c *SqliteClient) SaveThreadId(ctx context.Context, chatId string, threadId, asstId string) error {
+	c.logger.Info("SaveThreadId", "chatId", chatId, "threadId", threadId)
+
+	query := `INSERT INTO threads (chat_id, thread_id, asst_id) VALUES (?, ?, ?)`
+
+	_, err := c.db.ExecContext(ctx, query, chatId, threadId, asstId)
+	return err
+}
+
+func (c *SqliteClient) GetUserId(ctx context.Context, profileName string) (int, error) {
+	c.logger.Info("GetUserId", "profileName", profileName)
+
+	query := `SELECT user_id FROM profiles WHERE profile_name = ?`
+
+	userId := 0
+	err := c.db.QueryRowContext(ctx, query, profileName).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return userId, err
+}
+
+func (c *SqliteClient) GetStoreId(ctx context.Context, asstId string) (string, error) {
+	c.logger.Info("GetStoreId", "asstId", asstId)
+
+	query := `SELECT store_id FROM v_stores WHERE asst_id = ? LIMIT 1`
+
+	return c.queryString(ctx, query, asstId)
+}
+
+func (c *SqliteClient) SaveStoreRecord(ctx context.Context, storeId, storeName, asstId string) error {
+	c.logger.Info("SaveStoreRecord", "storeId", storeId, "storeName", storeName, "asstId", asstId)
+
+	query := `INSERT INTO v_stores (store_id, store_name, asst_id) VALUES (?, ?, ?)`
+
+	_, err := c.db.ExecContext(ctx, query, storeId, storeName, asstId)
+	return err
+}
+
+// queryString returns the single string column of the first row, or an
+// empty string when there is none.
+func (c *SqliteClient) queryString(ctx context.Context, query string, args ...any) (string, error) {
+	value := ""
+	err := c.db.QueryRowContext(ctx, query, args...).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+func nullInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
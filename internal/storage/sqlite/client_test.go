@@ -0,0 +1,219 @@
+package sqlite
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/config"
+	"github.com/mngn84/avito-cons/internal/storage"
+	"github.com/mngn84/avito-cons/internal/storage/schema"
+)
+
+// newTestClient opens an in-memory database and migrates it through the
+// connection of the client, as the server does on start.
+func newTestClient(t *testing.T) *SqliteClient {
+	t.Helper()
+
+	cfg := &config.Config{DB: config.PgConfig{
+		URL:            "sqlite://:memory:",
+		MigrationsPath: "file://../../../migrations",
+	}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	c, err := NewSqliteClient(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewSqliteClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	migrator, err := schema.NewMigrator(cfg, logger, c.DB())
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	defer migrator.Close()
+	if err := migrator.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.Version == 0 || status.Version != status.Latest || status.Dirty {
+		t.Fatalf("status = %+v, want the latest clean version", status)
+	}
+
+	return c
+}
+
+func TestMigratorKeepsStoreOpen(t *testing.T) {
+	c := newTestClient(t)
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping after migrations: %v", err)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	save := func(m storage.Message) int64 {
+		t.Helper()
+		id, err := c.SaveMessage(ctx, m)
+		if err != nil {
+			t.Fatalf("SaveMessage: %v", err)
+		}
+		return id
+	}
+
+	first := save(storage.Message{ChatId: "c1", UserId: 1, AvitoMsgId: "m1", Content: "hi", Role: "user", CreatedAt: 100})
+	if again := save(storage.Message{ChatId: "c1", UserId: 1, AvitoMsgId: "m1", Content: "hi", Role: "user", CreatedAt: 100}); again != first {
+		t.Fatalf("redelivered message got id %d, want %d", again, first)
+	}
+	// the reply is stored later than the next customer message
+	save(storage.Message{ChatId: "c1", UserId: 1, AvitoMsgId: "m2", Content: "price?", Role: "user", CreatedAt: 300})
+	save(storage.Message{ChatId: "c1", UserId: 1, AvitoMsgId: "r1", Content: "hello", Role: "assistant", CreatedAt: 200, SentAt: 200})
+	// dropped before sending, kept only for the audit
+	save(storage.Message{ChatId: "c1", UserId: 1, Content: "dropped", Role: "assistant", CreatedAt: 350, RunId: "run_1"})
+	save(storage.Message{ChatId: "c1", UserId: 1, AvitoMsgId: "m3", Content: "now", Role: "user", CreatedAt: 400})
+	save(storage.Message{ChatId: "c2", UserId: 1, AvitoMsgId: "x1", Content: "other", Role: "user", CreatedAt: 150})
+
+	history, err := c.GetMessages(ctx, 10, "c1", "m3")
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+
+	want := []storage.GptMsg{
+		{Role: "assistant", Content: "hello"},
+		{Role: "user", Content: "price?"},
+		{Role: "user", Content: "hi"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history = %+v, want %+v", history, want)
+	}
+	for i := range want {
+		if history[i] != want[i] {
+			t.Fatalf("history[%d] = %+v, want %+v", i, history[i], want[i])
+		}
+	}
+
+	limited, err := c.GetMessages(ctx, 1, "c1", "m3")
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(limited) != 1 || limited[0] != want[0] {
+		t.Fatalf("limited history = %+v, want the newest message", limited)
+	}
+}
+
+func TestDeliveries(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	id, err := c.SaveDelivery(ctx, storage.Delivery{
+		ChatId:      "c1",
+		UserId:      1,
+		SourceMsgId: "m1",
+		Content:     "hello",
+		Mode:        storage.SendModeAuto,
+		Status:      storage.DeliveryPending,
+	})
+	if err != nil {
+		t.Fatalf("SaveDelivery: %v", err)
+	}
+
+	// the echo of a send still in flight is matched by its text
+	if ok, err := c.IsDelivered(ctx, "c1", "a1", "hello"); err != nil || !ok {
+		t.Fatalf("IsDelivered pending = %t, %v, want true", ok, err)
+	}
+	if ok, err := c.IsDelivered(ctx, "c1", "a1", "something else"); err != nil || ok {
+		t.Fatalf("IsDelivered other text = %t, %v, want false", ok, err)
+	}
+
+	if ok, err := c.HasReply(ctx, "m1"); err != nil || !ok {
+		t.Fatalf("HasReply pending = %t, %v, want true", ok, err)
+	}
+
+	if err := c.UpdateDelivery(ctx, id, storage.DeliverySent, "a1"); err != nil {
+		t.Fatalf("UpdateDelivery: %v", err)
+	}
+	if ok, err := c.IsDelivered(ctx, "c1", "a1", ""); err != nil || !ok {
+		t.Fatalf("IsDelivered sent = %t, %v, want true", ok, err)
+	}
+	if ok, err := c.IsDelivered(ctx, "c1", "a2", "hello"); err != nil || ok {
+		t.Fatalf("IsDelivered after send = %t, %v, want false", ok, err)
+	}
+}
+
+func TestHasReplyIgnoresFailed(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	id, err := c.SaveDelivery(ctx, storage.Delivery{ChatId: "c1", UserId: 1, SourceMsgId: "m1", Content: "hello", Mode: storage.SendModeAuto, Status: storage.DeliveryPending})
+	if err != nil {
+		t.Fatalf("SaveDelivery: %v", err)
+	}
+	if err := c.UpdateDelivery(ctx, id, storage.DeliveryFailed, ""); err != nil {
+		t.Fatalf("UpdateDelivery: %v", err)
+	}
+
+	if ok, err := c.HasReply(ctx, "m1"); err != nil || ok {
+		t.Fatalf("HasReply failed = %t, %v, want false", ok, err)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	enqueue := func(msgId, chatId string) bool {
+		t.Helper()
+		ok, err := c.EnqueueJob(ctx, msgId, 1, chatId, []byte(`{}`), 3)
+		if err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+		return ok
+	}
+
+	if !enqueue("m1", "c1") || !enqueue("m2", "c1") || !enqueue("m3", "c2") {
+		t.Fatal("new messages were not queued")
+	}
+	if enqueue("m1", "c1") {
+		t.Fatal("a redelivered message was queued again")
+	}
+
+	jobs, err := c.LeaseJobs(ctx, "w1", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("LeaseJobs: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ChatId == jobs[1].ChatId {
+		t.Fatalf("leased %+v, want one job per chat", jobs)
+	}
+
+	// the second message of c1 waits until the first one is done
+	more, err := c.LeaseJobs(ctx, "w2", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("LeaseJobs: %v", err)
+	}
+	if len(more) != 0 {
+		t.Fatalf("leased %+v while the chats are busy", more)
+	}
+
+	for _, job := range jobs {
+		if err := c.CompleteJob(ctx, job.Id); err != nil {
+			t.Fatalf("CompleteJob: %v", err)
+		}
+	}
+
+	more, err = c.LeaseJobs(ctx, "w2", 10, time.Minute)
+	if err != nil {
+		t.Fatalf("LeaseJobs: %v", err)
+	}
+	if len(more) != 1 || more[0].ChatId != "c1" {
+		t.Fatalf("leased %+v, want the second job of c1", more)
+	}
+}
@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+func (c *SqliteClient) SaveDelivery(ctx context.Context, d storage.Delivery) (int64, error) {
+	c.logger.Info("SaveDelivery", "chatId", d.ChatId, "avitoMsgId", d.AvitoMsgId, "mode", d.Mode, "status", d.Status)
+
+	query := `INSERT INTO deliveries (chat_id, user_id, source_msg_id, avito_msg_id, content, mode, status)
+    VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	res, err := c.db.ExecContext(ctx, query, d.ChatId, d.UserId, d.SourceMsgId, nullString(d.AvitoMsgId), d.Content, d.Mode, d.Status)
+	if err != nil {
+		c.logger.Error("SaveDelivery", "err", err)
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+func (c *SqliteClient) UpdateDelivery(ctx context.Context, id int64, status, avitoMsgId string) error {
+	c.logger.Info("UpdateDelivery", "id", id, "status", status, "avitoMsgId", avitoMsgId)
+
+	query := `UPDATE deliveries SET status = ?, avito_msg_id = COALESCE(?, avito_msg_id) WHERE id = ?`
+
+	_, err := c.db.ExecContext(ctx, query, status, nullString(avitoMsgId), id)
+	return err
+}
+
+// HasReply reports whether a reply to the Avito message was sent, saved as a
+// draft or may have been sent.
+func (c *SqliteClient) HasReply(ctx context.Context, sourceMsgId string) (bool, error) {
+	query := `SELECT EXISTS (
+        SELECT 1 FROM deliveries WHERE source_msg_id = ? AND status <> 'failed'
+    )`
+
+	replied := false
+	err := c.db.QueryRowContext(ctx, query, sourceMsgId).Scan(&replied)
+	return replied, err
+}
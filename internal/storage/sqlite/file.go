@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+func (c *SqliteClient) SaveFileRecord(ctx context.Context, file storage.File) error {
+	c.logger.Info("SaveFileRecord", "storeId", file.StoreId, "fileId", file.FileId, "fileName", file.Name, "fileType", file.Type)
+
+	query := `INSERT INTO files (file_id, store_file_id, store_id, file_name, file_type, content_hash, size_bytes, status)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := c.db.ExecContext(ctx, query, file.FileId, nullString(file.StoreFileId), file.StoreId, file.Name, file.Type, file.ContentHash, file.Size, file.Status)
+	if err != nil {
+		c.logger.Error("SaveFileRecord", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *SqliteClient) UpdateFileStatus(ctx context.Context, fileId, storeFileId, status string) error {
+	c.logger.Info("UpdateFileStatus", "fileId", fileId, "storeFileId", storeFileId, "status", status)
+
+	query := `UPDATE files
+    SET store_file_id = COALESCE(NULLIF(?, ''), store_file_id), status = ?, updated_at = unixepoch()
+    WHERE file_id = ?`
+
+	_, err := c.db.ExecContext(ctx, query, storeFileId, status, fileId)
+	return err
+}
+
+// GetFiles returns every record of the file name in the store, newest first.
+func (c *SqliteClient) GetFiles(ctx context.Context, storeId, fileName, fileType string) ([]storage.File, error) {
+	c.logger.Info("GetFiles", "storeId", storeId, "fileName", fileName, "fileType", fileType)
+
+	query := `SELECT file_id, COALESCE(store_file_id, ''), store_id, file_name, file_type,
+    COALESCE(content_hash, ''), COALESCE(size_bytes, 0), status, created_at, updated_at
+    FROM files
+     WHERE store_id = ? AND file_name = ? AND file_type = ?
+     ORDER BY created_at DESC, rowid DESC`
+
+	rows, err := c.db.QueryContext(ctx, query, storeId, fileName, fileType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []storage.File{}
+	for rows.Next() {
+		var f storage.File
+		var createdAt, updatedAt int64
+		err := rows.Scan(
+			&f.FileId,
+			&f.StoreFileId,
+			&f.StoreId,
+			&f.Name,
+			&f.Type,
+			&f.ContentHash,
+			&f.Size,
+			&f.Status,
+			&createdAt,
+			&updatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		f.CreatedAt = time.Unix(createdAt, 0)
+		f.UpdatedAt = time.Unix(updatedAt, 0)
+		files = append(files, f)
+	}
+
+	return files, rows.Err()
+}
+
+func (c *SqliteClient) DeleteFileRecord(ctx context.Context, fileId string) error {
+	c.logger.Info("DeleteFileRecord", "fileId", fileId)
+
+	query := `DELETE FROM files WHERE file_id = ?`
+
+	_, err := c.db.ExecContext(ctx, query, fileId)
+	return err
+}
@@ -0,0 +1,47 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+// SaveMessage stores a message and returns its id. An inbound message that
+// is already stored under the same Avito id is kept and its id returned.
+func (c *SqliteClient) SaveMessage(ctx context.Context, m storage.Message) (int64, error) {
+	c.logger.Info("SaveMessage", "chatId", m.ChatId, "avitoMsgId", m.AvitoMsgId, "role", m.Role)
+
+	query := `INSERT INTO messages (chat_id, user_id, avito_msg_id, content, role, created_at,
+        thread_id, run_id, prompt_tokens, completion_tokens, total_tokens, sent_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    ON CONFLICT (avito_msg_id) WHERE role = 'user' DO NOTHING
+    RETURNING id`
+
+	var id int64
+	err := c.db.QueryRowContext(
+		ctx,
+		query,
+		m.ChatId,
+		m.UserId,
+		nullString(m.AvitoMsgId),
+		m.Content,
+		m.Role,
+		m.CreatedAt,
+		nullString(m.ThreadId),
+		nullString(m.RunId),
+		nullInt(m.PromptTokens),
+		nullInt(m.CompletionTokens),
+		nullInt(m.TotalTokens),
+		nullInt(m.SentAt),
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = c.db.QueryRowContext(ctx, `SELECT id FROM messages WHERE avito_msg_id = ? AND role = 'user'`, m.AvitoMsgId).Scan(&id)
+	}
+	if err != nil {
+		c.logger.Error("SaveMessage", "err", err)
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mngn84/avito-cons/internal/storage"
+)
+
+// EnqueueJob records the Avito message id and queues the payload in one
+// transaction. It returns false without queueing anything when the message id
+// was already received; messages without an id are never deduplicated.
+func (c *SqliteClient) EnqueueJob(ctx context.Context, msgId string, userId int, chatId string, payload []byte, maxAttempts int) (bool, error) {
+	c.logger.Info("EnqueueJob", "msgId", msgId, "chatId", chatId)
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if msgId != "" {
+		query := `INSERT INTO webhook_events (msg_id, user_id, chat_id) VALUES (?, ?, ?)
+        ON CONFLICT (msg_id) DO NOTHING`
+
+		result, err := tx.ExecContext(ctx, query, msgId, userId, chatId)
+		if err != nil {
+			c.logger.Error("EnqueueJob", "err", err)
+			return false, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if rowsAffected == 0 {
+			return false, nil
+		}
+	}
+
+	query := `INSERT INTO message_queue (chat_id, payload, max_attempts) VALUES (?, ?, ?)`
+
+	if _, err := tx.ExecContext(ctx, query, chatId, payload, maxAttempts); err != nil {
+		c.logger.Error("EnqueueJob", "err", err)
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// LeaseJobs locks up to limit ready jobs for workerId until the lease expires.
+// Only the oldest unfinished job of each chat is eligible, so messages of one
+// chat are processed in order and never concurrently. A single UPDATE is
+// atomic in SQLite, which stands in for FOR UPDATE SKIP LOCKED.
+func (c *SqliteClient) LeaseJobs(ctx context.Context, workerId string, limit int, lease time.Duration) ([]storage.Job, error) {
+	query := `UPDATE message_queue
+    SET status = 'processing',
+        locked_by = ?,
+        locked_until = unixepoch() + ?,
+        attempts = attempts + 1,
+        updated_at = unixepoch()
+    WHERE id IN (
+        SELECT m.id
+        FROM message_queue m
+        WHERE ((m.status = 'pending' AND m.run_at <= unixepoch())
+            OR (m.status = 'processing' AND m.locked_until < unixepoch()))
+          AND NOT EXISTS (
+            SELECT 1 FROM message_queue p
+            WHERE p.chat_id = m.chat_id
+              AND p.id < m.id
+              AND p.status IN ('pending', 'processing'))
+        ORDER BY m.id
+        LIMIT ?
+    )
+    RETURNING id, chat_id, payload, attempts, max_attempts`
+
+	rows, err := c.db.QueryContext(ctx, query, workerId, seconds(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []storage.Job{}
+	for rows.Next() {
+		var job storage.Job
+		err := rows.Scan(
+			&job.Id,
+			&job.ChatId,
+			&job.Payload,
+			&job.Attempts,
+			&job.MaxAttempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Id < jobs[j].Id })
+	return jobs, nil
+}
+
+func (c *SqliteClient) CompleteJob(ctx context.Context, id int64) error {
+	c.logger.Info("CompleteJob", "id", id)
+
+	query := `UPDATE message_queue
+    SET status = 'done', locked_by = NULL, locked_until = NULL, updated_at = unixepoch()
+    WHERE id = ?`
+
+	_, err := c.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// FailJob releases the job for another attempt after delay, or moves it to
+// the dead letter state once max_attempts is reached.
+func (c *SqliteClient) FailJob(ctx context.Context, id int64, lastErr string, delay time.Duration) (string, error) {
+	c.logger.Info("FailJob", "id", id, "err", lastErr)
+
+	query := `UPDATE message_queue
+    SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+        last_error = ?,
+        run_at = unixepoch() + ?,
+        locked_by = NULL,
+        locked_until = NULL,
+        updated_at = unixepoch()
+    WHERE id = ?
+    RETURNING status`
+
+	status := ""
+	if err := c.db.QueryRowContext(ctx, query, lastErr, seconds(delay), id).Scan(&status); err != nil {
+		c.logger.Error("FailJob", "err", err)
+		return "", err
+	}
+
+	return status, nil
+}
+
+func (c *SqliteClient) DeadJob(ctx context.Context, id int64, lastErr string) error {
+	c.logger.Info("DeadJob", "id", id, "err", lastErr)
+
+	query := `UPDATE message_queue
+    SET status = 'dead', last_error = ?, locked_by = NULL, locked_until = NULL, updated_at = unixepoch()
+    WHERE id = ?`
+
+	_, err := c.db.ExecContext(ctx, query, lastErr, id)
+	return err
+}
+
+func (c *SqliteClient) SetEventState(ctx context.Context, msgId, state string) error {
+	c.logger.Info("SetEventState", "msgId", msgId, "state", state)
+
+	query := `UPDATE webhook_events SET state = ?, updated_at = unixepoch() WHERE msg_id = ?`
+
+	_, err := c.db.ExecContext(ctx, query, state, msgId)
+	return err
+}
+
+// seconds rounds up, timestamps are whole seconds
+func seconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,21 @@
+package sqlite
+
+import "context"
+
+// GetTranscript returns an empty string when the message was not transcribed.
+func (c *SqliteClient) GetTranscript(ctx context.Context, msgId string) (string, error) {
+	c.logger.Info("GetTranscript", "msgId", msgId)
+
+	query := `SELECT COALESCE(transcript, '') FROM webhook_events WHERE msg_id = ?`
+
+	return c.queryString(ctx, query, msgId)
+}
+
+func (c *SqliteClient) SaveTranscript(ctx context.Context, msgId, transcript string) error {
+	c.logger.Info("SaveTranscript", "msgId", msgId)
+
+	query := `UPDATE webhook_events SET transcript = ?, updated_at = unixepoch() WHERE msg_id = ?`
+
+	_, err := c.db.ExecContext(ctx, query, transcript, msgId)
+	return err
+}
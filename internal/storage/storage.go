@@ -0,0 +1,122 @@
+// Package storage describes what the services need from the database. It is
+// implemented on Postgres by the pg package and on SQLite by the sqlite
+// package; the memory package keeps everything in process for tests.
+// Every method takes the context of the request it is made for.
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+type AssistantRepo interface {
+	// GetAssistantId returns an empty id when the user has no assistant.
+	GetAssistantId(ctx context.Context, userId int) (string, error)
+	SaveAssistant(ctx context.Context, asstId, asstName string, userId int) error
+	// GetStoreId returns the vector store of the assistant or an empty id.
+	GetStoreId(ctx context.Context, asstId string) (string, error)
+	SaveStoreRecord(ctx context.Context, storeId, storeName, asstId string) error
+}
+
+type ThreadRepo interface {
+	// GetThreadId returns an empty id when the chat has no thread yet.
+	GetThreadId(ctx context.Context, chatId string) (string, error)
+	SaveThreadId(ctx context.Context, chatId string, threadId, asstId string) error
+}
+
+type FileRepo interface {
+	SaveFileRecord(ctx context.Context, file File) error
+	UpdateFileStatus(ctx context.Context, fileId, storeFileId, status string) error
+	// GetFiles returns every record of the file name in the store, newest first.
+	GetFiles(ctx context.Context, storeId, fileName, fileType string) ([]File, error)
+	DeleteFileRecord(ctx context.Context, fileId string) error
+}
+
+type MessageRepo interface {
+	// GetMessages returns the newest messages of the chat in the order they
+	// were stored, newest first, leaving out the inbound message msgId and
+	// replies that were not sent.
+	GetMessages(ctx context.Context, limit int, chatId string, msgId string) ([]GptMsg, error)
+	// SaveMessage stores a message and returns its id. An inbound message
+	// already stored under the same Avito id is kept and its id returned.
+	SaveMessage(ctx context.Context, m Message) (int64, error)
+}
+
+type ProfileRepo interface {
+	// GetProfile returns nil without an error for an unknown user.
+	GetProfile(ctx context.Context, userId int) (*Profile, error)
+	ListProfiles(ctx context.Context) ([]Profile, error)
+	// GetUserId returns 0 for an unknown profile name.
+	GetUserId(ctx context.Context, profileName string) (int, error)
+}
+
+type ChatStateRepo interface {
+	// GetChatState returns nil without an error when the bot state of the
+	// chat was never changed.
+	GetChatState(ctx context.Context, userId int, chatId string) (*ChatState, error)
+	SetChatState(ctx context.Context, s ChatState) error
+	// IsDelivered reports whether the Avito message was sent by us: by its id,
+	// or by the text of a recent delivery to the chat still pending.
+	IsDelivered(ctx context.Context, chatId, avitoMsgId, content string) (bool, error)
+}
+
+type DeliveryRepo interface {
+	// SaveDelivery returns the id of the new delivery.
+	SaveDelivery(ctx context.Context, d Delivery) (int64, error)
+	UpdateDelivery(ctx context.Context, id int64, status, avitoMsgId string) error
+	// HasReply reports whether a reply to the Avito message was sent, saved
+	// as a draft or may have been sent; only failed deliveries do not count.
+	HasReply(ctx context.Context, sourceMsgId string) (bool, error)
+}
+
+type QueueRepo interface {
+	// EnqueueJob returns false without queueing anything when the message id
+	// was already received; messages without an id are never deduplicated.
+	EnqueueJob(ctx context.Context, msgId string, userId int, chatId string, payload []byte, maxAttempts int) (bool, error)
+	// LeaseJobs locks up to limit ready jobs for workerId until the lease
+	// expires, at most one per chat.
+	LeaseJobs(ctx context.Context, workerId string, limit int, lease time.Duration) ([]Job, error)
+	CompleteJob(ctx context.Context, id int64) error
+	// FailJob returns the new status of the job: pending or dead.
+	FailJob(ctx context.Context, id int64, lastErr string, delay time.Duration) (string, error)
+	DeadJob(ctx context.Context, id int64, lastErr string) error
+	SetEventState(ctx context.Context, msgId, state string) error
+}
+
+type TranscriptRepo interface {
+	// GetTranscript returns an empty string when the message was not
+	// transcribed.
+	GetTranscript(ctx context.Context, msgId string) (string, error)
+	SaveTranscript(ctx context.Context, msgId, transcript string) error
+}
+
+type Pinger interface {
+	// Ping checks that the database is reachable.
+	Ping(ctx context.Context) error
+}
+
+// AssistantStore is what the assistants backend keeps: assistants with their
+// vector stores and files, the thread of every chat, and the user id of a
+// profile name for uploads.
+type AssistantStore interface {
+	AssistantRepo
+	ThreadRepo
+	FileRepo
+	ProfileRepo
+}
+
+// Store is everything the bot keeps in the database.
+type Store interface {
+	Pinger
+	Close() error
+
+	AssistantRepo
+	ThreadRepo
+	FileRepo
+	MessageRepo
+	ProfileRepo
+	ChatStateRepo
+	DeliveryRepo
+	QueueRepo
+	TranscriptRepo
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS v_files;
+DROP TABLE IF EXISTS files;
+DROP TABLE IF EXISTS v_stores;
+DROP TABLE IF EXISTS threads;
+DROP TABLE IF EXISTS assistants;
+DROP TABLE IF EXISTS profiles;
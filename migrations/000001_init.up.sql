@@ -0,0 +1,49 @@
+-- the tables the bot used before schema migrations were managed, adopted
+-- as they are by IF NOT EXISTS; the queue starts with 000002
+CREATE TABLE IF NOT EXISTS profiles (
+    user_id      BIGINT PRIMARY KEY,
+    profile_name TEXT   NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS assistants (
+    asst_id   TEXT   PRIMARY KEY,
+    asst_name TEXT   NOT NULL,
+    user_id   BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS threads (
+    chat_id   TEXT PRIMARY KEY,
+    thread_id TEXT NOT NULL,
+    asst_id   TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS v_stores (
+    store_id   TEXT PRIMARY KEY,
+    store_name TEXT NOT NULL,
+    asst_id    TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS files (
+    file_id   TEXT PRIMARY KEY,
+    file_name TEXT NOT NULL,
+    file_type TEXT NOT NULL,
+    store_id  TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS v_files (
+    file_id   TEXT PRIMARY KEY,
+    file_name TEXT NOT NULL,
+    file_type TEXT NOT NULL,
+    store_id  TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id         BIGSERIAL   PRIMARY KEY,
+    chat_id    TEXT        NOT NULL,
+    user_id    BIGINT      NOT NULL,
+    content    TEXT        NOT NULL,
+    role       TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS messages_chat_id_created_at_idx ON messages (chat_id, created_at);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS message_queue (
+    id           BIGSERIAL   PRIMARY KEY,
+    chat_id      TEXT        NOT NULL,
+    payload      JSONB       NOT NULL,
+    status       TEXT        NOT NULL DEFAULT 'pending',
+    attempts     INT         NOT NULL DEFAULT 0,
+    max_attempts INT         NOT NULL,
+    last_error   TEXT,
+    run_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_by    TEXT,
+    locked_until TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS message_queue_ready_idx ON message_queue (status, run_at)
+    WHERE status IN ('pending', 'processing');
+CREATE INDEX IF NOT EXISTS message_queue_chat_id_idx ON message_queue (chat_id, id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS deliveries;
+
+ALTER TABLE profiles DROP COLUMN IF EXISTS send_mode;
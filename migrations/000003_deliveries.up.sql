@@ -0,0 +1,15 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS send_mode TEXT NOT NULL DEFAULT 'auto';
+
+CREATE TABLE IF NOT EXISTS deliveries (
+    id            BIGSERIAL   PRIMARY KEY,
+    chat_id       TEXT        NOT NULL,
+    user_id       BIGINT      NOT NULL,
+    source_msg_id TEXT        NOT NULL,
+    avito_msg_id  TEXT,
+    content       TEXT        NOT NULL,
+    mode          TEXT        NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS deliveries_chat_id_idx ON deliveries (chat_id, created_at);
+CREATE INDEX IF NOT EXISTS deliveries_avito_msg_id_idx ON deliveries (avito_msg_id);
@@ -0,0 +1,2 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS client_secret;
+ALTER TABLE profiles DROP COLUMN IF EXISTS client_id;
@@ -0,0 +1,2 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS client_id TEXT;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS client_secret TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS model;
+ALTER TABLE profiles DROP COLUMN IF EXISTS system_prompt;
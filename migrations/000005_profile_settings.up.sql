@@ -0,0 +1,2 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS system_prompt TEXT;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS model TEXT;
@@ -0,0 +1,3 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS webhook_ips;
+ALTER TABLE profiles DROP COLUMN IF EXISTS webhook_secret;
+ALTER TABLE profiles DROP COLUMN IF EXISTS webhook_auth;
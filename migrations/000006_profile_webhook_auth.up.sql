@@ -0,0 +1,3 @@
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS webhook_auth TEXT;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS webhook_secret TEXT;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS webhook_ips TEXT;
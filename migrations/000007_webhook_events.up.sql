@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS webhook_events (
+    msg_id     TEXT        PRIMARY KEY,
+    user_id    BIGINT      NOT NULL,
+    chat_id    TEXT        NOT NULL,
+    state      TEXT        NOT NULL DEFAULT 'received',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1 @@
+ALTER TABLE webhook_events ADD COLUMN IF NOT EXISTS transcript TEXT;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS chat_states (
+    chat_id      TEXT        PRIMARY KEY,
+    user_id      BIGINT      NOT NULL,
+    state        TEXT        NOT NULL DEFAULT 'active',
+    paused_until TIMESTAMPTZ,
+    reason       TEXT,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS messages_inbound_avito_msg_id_idx;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS recorded_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS sent_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS total_tokens;
+ALTER TABLE messages DROP COLUMN IF EXISTS completion_tokens;
+ALTER TABLE messages DROP COLUMN IF EXISTS prompt_tokens;
+ALTER TABLE messages DROP COLUMN IF EXISTS run_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS thread_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS avito_msg_id;
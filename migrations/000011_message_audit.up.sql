@@ -0,0 +1,11 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS avito_msg_id TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS thread_id TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS run_id TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS prompt_tokens INT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS completion_tokens INT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS total_tokens INT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS sent_at TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS recorded_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE UNIQUE INDEX IF NOT EXISTS messages_inbound_avito_msg_id_idx ON messages (avito_msg_id)
+    WHERE role = 'user';
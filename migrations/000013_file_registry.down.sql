@@ -0,0 +1,19 @@
+DROP INDEX IF EXISTS files_store_id_file_name_idx;
+
+ALTER TABLE files DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE files DROP COLUMN IF EXISTS created_at;
+ALTER TABLE files DROP COLUMN IF EXISTS status;
+ALTER TABLE files DROP COLUMN IF EXISTS size_bytes;
+ALTER TABLE files DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE files DROP COLUMN IF EXISTS store_file_id;
+
+CREATE TABLE IF NOT EXISTS v_files (
+    file_id   TEXT PRIMARY KEY,
+    file_name TEXT NOT NULL,
+    file_type TEXT NOT NULL,
+    store_id  TEXT NOT NULL
+);
+
+INSERT INTO v_files (file_id, file_name, file_type, store_id)
+SELECT file_id, file_name, file_type, store_id FROM files
+ON CONFLICT (file_id) DO NOTHING;
@@ -0,0 +1,19 @@
+-- uploads used to go to files while lookups and deletes went to v_files,
+-- both are merged into files
+INSERT INTO files (file_id, file_name, file_type, store_id)
+SELECT file_id, file_name, file_type, store_id FROM v_files
+ON CONFLICT (file_id) DO NOTHING;
+
+DROP TABLE IF EXISTS v_files;
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS store_file_id TEXT;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS content_hash TEXT;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS size_bytes BIGINT;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'completed';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE files ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- vector store files share the id of the file they were created from
+UPDATE files SET store_file_id = file_id WHERE store_file_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS files_store_id_file_name_idx ON files (store_id, file_name, file_type);
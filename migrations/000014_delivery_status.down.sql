@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS deliveries_pending_idx;
+ALTER TABLE deliveries DROP COLUMN IF EXISTS status;
@@ -0,0 +1,7 @@
+-- deliveries are recorded before sending; rows from before were all sent or
+-- saved as drafts
+ALTER TABLE deliveries ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'sent';
+UPDATE deliveries SET status = 'draft' WHERE mode = 'draft';
+
+CREATE INDEX IF NOT EXISTS deliveries_pending_idx ON deliveries (chat_id, created_at)
+    WHERE status = 'pending';
@@ -0,0 +1,8 @@
+-- keep the newest state of a chat id used by several accounts
+DELETE FROM chat_states a
+ USING chat_states b
+ WHERE a.chat_id = b.chat_id
+   AND (a.updated_at, a.user_id) < (b.updated_at, b.user_id);
+
+ALTER TABLE chat_states DROP CONSTRAINT IF EXISTS chat_states_pkey;
+ALTER TABLE chat_states ADD PRIMARY KEY (chat_id);
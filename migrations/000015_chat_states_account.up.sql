@@ -0,0 +1,4 @@
+-- chat ids are only unique within an account, and a webhook for one account
+-- must not change the state of a chat of another
+ALTER TABLE chat_states DROP CONSTRAINT IF EXISTS chat_states_pkey;
+ALTER TABLE chat_states ADD PRIMARY KEY (user_id, chat_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS deliveries_source_msg_id_idx;
@@ -0,0 +1,3 @@
+-- the backfilled rows cannot be told apart from sent replies, they keep
+-- their sent_at
+SELECT 1;
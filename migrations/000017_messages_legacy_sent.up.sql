@@ -0,0 +1,5 @@
+-- replies without sent_at are left out of the chat context. Replies stored
+-- before the audit columns were all sent, they have no run or usage.
+UPDATE messages SET sent_at = created_at
+ WHERE role = 'assistant' AND sent_at IS NULL
+   AND thread_id IS NULL AND run_id IS NULL AND total_tokens IS NULL;
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS chat_states;
+DROP TABLE IF EXISTS webhook_events;
+DROP TABLE IF EXISTS deliveries;
+DROP TABLE IF EXISTS message_queue;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS files;
+DROP TABLE IF EXISTS v_stores;
+DROP TABLE IF EXISTS threads;
+DROP TABLE IF EXISTS assistants;
+DROP TABLE IF EXISTS profiles;
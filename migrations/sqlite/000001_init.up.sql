@@ -0,0 +1,122 @@
+-- the schema of the Postgres migrations up to 000013 at once; timestamps are
+-- unix seconds
+
+CREATE TABLE IF NOT EXISTS profiles (
+    user_id        INTEGER PRIMARY KEY,
+    profile_name   TEXT    NOT NULL UNIQUE,
+    client_id      TEXT,
+    client_secret  TEXT,
+    system_prompt  TEXT,
+    model          TEXT,
+    send_mode      TEXT    NOT NULL DEFAULT 'auto',
+    webhook_auth   TEXT,
+    webhook_secret TEXT,
+    webhook_ips    TEXT,
+    backend        TEXT,
+    provider       TEXT
+);
+
+CREATE TABLE IF NOT EXISTS assistants (
+    asst_id   TEXT    PRIMARY KEY,
+    asst_name TEXT    NOT NULL,
+    user_id   INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS threads (
+    chat_id   TEXT PRIMARY KEY,
+    thread_id TEXT NOT NULL,
+    asst_id   TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS v_stores (
+    store_id   TEXT PRIMARY KEY,
+    store_name TEXT NOT NULL,
+    asst_id    TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS files (
+    file_id       TEXT    PRIMARY KEY,
+    store_file_id TEXT,
+    store_id      TEXT    NOT NULL,
+    file_name     TEXT    NOT NULL,
+    file_type     TEXT    NOT NULL,
+    content_hash  TEXT,
+    size_bytes    INTEGER,
+    status        TEXT    NOT NULL DEFAULT 'completed',
+    created_at    INTEGER NOT NULL DEFAULT (unixepoch()),
+    updated_at    INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX IF NOT EXISTS files_store_id_file_name_idx ON files (store_id, file_name, file_type);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id           TEXT    NOT NULL,
+    user_id           INTEGER NOT NULL,
+    avito_msg_id      TEXT,
+    content           TEXT    NOT NULL,
+    role              TEXT    NOT NULL,
+    created_at        INTEGER NOT NULL DEFAULT (unixepoch()),
+    thread_id         TEXT,
+    run_id            TEXT,
+    prompt_tokens     INTEGER,
+    completion_tokens INTEGER,
+    total_tokens      INTEGER,
+    sent_at           INTEGER,
+    recorded_at       INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX IF NOT EXISTS messages_chat_id_created_at_idx ON messages (chat_id, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS messages_inbound_avito_msg_id_idx ON messages (avito_msg_id)
+    WHERE role = 'user';
+
+CREATE TABLE IF NOT EXISTS message_queue (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id      TEXT    NOT NULL,
+    payload      BLOB    NOT NULL,
+    status       TEXT    NOT NULL DEFAULT 'pending',
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    last_error   TEXT,
+    run_at       INTEGER NOT NULL DEFAULT (unixepoch()),
+    locked_by    TEXT,
+    locked_until INTEGER,
+    created_at   INTEGER NOT NULL DEFAULT (unixepoch()),
+    updated_at   INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX IF NOT EXISTS message_queue_ready_idx ON message_queue (status, run_at);
+CREATE INDEX IF NOT EXISTS message_queue_chat_id_idx ON message_queue (chat_id, id);
+
+CREATE TABLE IF NOT EXISTS deliveries (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id       TEXT    NOT NULL,
+    user_id       INTEGER NOT NULL,
+    source_msg_id TEXT    NOT NULL,
+    avito_msg_id  TEXT,
+    content       TEXT    NOT NULL,
+    mode          TEXT    NOT NULL,
+    created_at    INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE INDEX IF NOT EXISTS deliveries_chat_id_idx ON deliveries (chat_id, created_at);
+CREATE INDEX IF NOT EXISTS deliveries_avito_msg_id_idx ON deliveries (avito_msg_id);
+
+CREATE TABLE IF NOT EXISTS webhook_events (
+    msg_id     TEXT    PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    chat_id    TEXT    NOT NULL,
+    state      TEXT    NOT NULL DEFAULT 'received',
+    transcript TEXT,
+    created_at INTEGER NOT NULL DEFAULT (unixepoch()),
+    updated_at INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+CREATE TABLE IF NOT EXISTS chat_states (
+    chat_id      TEXT    PRIMARY KEY,
+    user_id      INTEGER NOT NULL,
+    state        TEXT    NOT NULL DEFAULT 'active',
+    paused_until INTEGER,
+    reason       TEXT,
+    updated_at   INTEGER NOT NULL DEFAULT (unixepoch())
+);
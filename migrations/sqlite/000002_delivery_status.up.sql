@@ -0,0 +1,5 @@
+ALTER TABLE deliveries ADD COLUMN status TEXT NOT NULL DEFAULT 'sent';
+UPDATE deliveries SET status = 'draft' WHERE mode = 'draft';
+
+CREATE INDEX IF NOT EXISTS deliveries_pending_idx ON deliveries (chat_id, created_at)
+    WHERE status = 'pending';
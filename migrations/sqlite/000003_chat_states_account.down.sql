@@ -0,0 +1,16 @@
+CREATE TABLE chat_states_old (
+    chat_id      TEXT    PRIMARY KEY,
+    user_id      INTEGER NOT NULL,
+    state        TEXT    NOT NULL DEFAULT 'active',
+    paused_until INTEGER,
+    reason       TEXT,
+    updated_at   INTEGER NOT NULL DEFAULT (unixepoch())
+);
+
+-- keep the newest state of a chat id used by several accounts
+INSERT OR REPLACE INTO chat_states_old (chat_id, user_id, state, paused_until, reason, updated_at)
+SELECT chat_id, user_id, state, paused_until, reason, updated_at FROM chat_states
+ ORDER BY updated_at, user_id;
+
+DROP TABLE chat_states;
+ALTER TABLE chat_states_old RENAME TO chat_states;
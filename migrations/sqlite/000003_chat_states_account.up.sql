@@ -0,0 +1,17 @@
+-- chat ids are only unique within an account, and a webhook for one account
+-- must not change the state of a chat of another
+CREATE TABLE chat_states_new (
+    chat_id      TEXT    NOT NULL,
+    user_id      INTEGER NOT NULL,
+    state        TEXT    NOT NULL DEFAULT 'active',
+    paused_until INTEGER,
+    reason       TEXT,
+    updated_at   INTEGER NOT NULL DEFAULT (unixepoch()),
+    PRIMARY KEY (user_id, chat_id)
+);
+
+INSERT INTO chat_states_new (chat_id, user_id, state, paused_until, reason, updated_at)
+SELECT chat_id, user_id, state, paused_until, reason, updated_at FROM chat_states;
+
+DROP TABLE chat_states;
+ALTER TABLE chat_states_new RENAME TO chat_states;
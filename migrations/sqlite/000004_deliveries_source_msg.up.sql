@@ -0,0 +1,2 @@
+-- a retried job looks up the reply to its message before running again
+CREATE INDEX IF NOT EXISTS deliveries_source_msg_id_idx ON deliveries (source_msg_id);
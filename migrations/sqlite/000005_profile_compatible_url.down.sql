@@ -0,0 +1 @@
+ALTER TABLE profiles DROP COLUMN compatible_url;
@@ -0,0 +1,2 @@
+-- server of the compatible provider, LLM_COMPATIBLE_URL when empty
+ALTER TABLE profiles ADD COLUMN compatible_url TEXT;